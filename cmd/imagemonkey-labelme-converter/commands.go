@@ -0,0 +1,753 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/convert"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/imagemonkey"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/source"
+)
+
+//addDatasetFlags registers the dataset flags. The flags default to the values of
+//the environment and overwrite them when set.
+func addDatasetFlags(fs *flag.FlagSet, env *Environment) {
+	fs.StringVar(&env.Source, "source", env.Source, fmt.Sprintf("source dataset the images are taken from %v", source.Names()))
+	fs.StringVar(&env.DatasetDirectory, "dataset", env.DatasetDirectory, "directory the dataset is stored in")
+	fs.BoolVar(&env.UseCache, "cache", env.UseCache, "read and write the cache directory of the dataset")
+	fs.IntVar(&env.ParseWorkers, "parse-workers", env.ParseWorkers, "number of annotations that are parsed in parallel")
+	fs.BoolVar(&env.ObjectOptions.IncludeDeleted, "include-deleted", env.ObjectOptions.IncludeDeleted, "include objects that were deleted in LabelMe")
+	fs.BoolVar(&env.ObjectOptions.OnlyVerified, "only-verified", env.ObjectOptions.OnlyVerified, "only include verified objects")
+	fs.StringVar(&env.LabelMappingFile, "label-mapping", env.LabelMappingFile, "yaml file that maps LabelMe names to ImageMonkey labels")
+}
+
+func addApiFlags(fs *flag.FlagSet, env *Environment) {
+	fs.StringVar(&env.ApiBaseUrl, "api", env.ApiBaseUrl, "base url of the ImageMonkey API")
+	fs.DurationVar(&env.ClientOptions.Timeout, "api-timeout", env.ClientOptions.Timeout, "timeout of a single request to the ImageMonkey API")
+	fs.IntVar(&env.ClientOptions.Retries, "api-retries", env.ClientOptions.Retries, "number of retries of requests that failed temporarily (network errors, 429, 5xx; donations only on 429 and connection errors)")
+	fs.Float64Var(&env.ClientOptions.RequestsPerSecond, "rps", env.ClientOptions.RequestsPerSecond, "maximum number of requests per second to the ImageMonkey API (0 = unlimited)")
+}
+
+//addFilterFlags registers the -where flag and returns the where expression
+func addFilterFlags(fs *flag.FlagSet) *string {
+	return fs.String("where", "", "only consider objects that match this expression, e.g. 'name ~ \"^car\" and !occluded and area > 500'")
+}
+
+//newObjectFilter compiles the filter for the objects of the given label. label
+//and where can both be empty, but not at the same time.
+func newObjectFilter(src source.Source, label string, where string) (*labelme.ObjectFilter, error) {
+	filter, err := labelme.NewLabelFilter(label, where, src.GetLabelMapper())
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %s", err.Error())
+	}
+	return filter, nil
+}
+
+//selectImageInfos returns the images that contain objects of the given label. With
+//a where expression the annotations have to be parsed, as neither the index nor the
+//cache know about it. The area and the points of mask objects are only known after
+//the masks were resolved, so for sources with masks the images with mask objects of
+//the label are selected as well and the filter is checked again when they are pushed.
+func selectImageInfos(src source.Source, label string, filter *labelme.ObjectFilter, where string) ([]labelme.ImageInfo, error) {
+	if where == "" {
+		return src.GetImageInfos(label)
+	}
+	if _, ok := src.(source.MaskResolver); ok && filter.UsesGeometry() {
+		//objects without points are the masks that weren't resolved yet
+		candidates, err := newObjectFilter(src, label, "("+where+") or points = 0")
+		if err != nil {
+			return nil, err
+		}
+		return src.FindImageInfos(candidates), nil
+	}
+	return src.FindImageInfos(filter), nil
+}
+
+//newSource creates the source of the environment without loading it
+func newSource(env Environment) (source.Source, error) {
+	options := source.Options{
+		Directory: env.DatasetDirectory,
+		UseCache: env.UseCache,
+		ObjectOptions: env.ObjectOptions,
+		ParseWorkers: env.ParseWorkers,
+		DownloadOptions: env.DownloadOptions,
+		MirrorConcurrency: env.MirrorConcurrency,
+	}
+	if env.LabelMappingFile != "" {
+		labelMapper, err := labelme.ReadLabelMapper(env.LabelMappingFile)
+		if err != nil {
+			return nil, err
+		}
+		options.LabelMapper = labelMapper
+	}
+	return source.Open(env.Source, options)
+}
+
+func openSource(ctx context.Context, env Environment) (source.Source, error) {
+	src, err := newSource(env)
+	if err != nil {
+		return nil, err
+	}
+	err = src.LoadContext(ctx)
+	return src, err
+}
+
+//requireLabelMe refuses commands that only work with the LabelMe dataset, like
+//the mirror, the index and the image exceptions
+func requireLabelMe(env Environment) error {
+	if env.Source != "labelme" {
+		return fmt.Errorf("only supported by the labelme source, not by %s", env.Source)
+	}
+	return nil
+}
+
+//newDataset creates the LabelMe dataset of the environment without loading it
+func newDataset(env Environment) (*labelme.Dataset, error) {
+	err := requireLabelMe(env)
+	if err != nil {
+		return nil, err
+	}
+	src, err := newSource(env)
+	if err != nil {
+		return nil, err
+	}
+	return src.(*labelme.Dataset), nil
+}
+
+func openDataset(ctx context.Context, env Environment) (*labelme.Dataset, error) {
+	labelMeDataset, err := newDataset(env)
+	if err != nil {
+		return nil, err
+	}
+	err = labelMeDataset.LoadContext(ctx)
+	return labelMeDataset, err
+}
+
+func newImageMonkeyAPI(env Environment, src source.Source) *imagemonkey.Client {
+	imageMonkeyAPI := imagemonkey.NewClient(env.ApiBaseUrl, env.ClientId, env.ClientSecret)
+	options := env.ClientOptions
+	options.OnRetry = func(err error, delay time.Duration) {
+		fmt.Printf("%s...retrying in %s\n", err.Error(), delay)
+	}
+	imageMonkeyAPI.SetClientOptions(options)
+	//every environment gets its own label catalogue
+	h := fnv.New32a()
+	h.Write([]byte(env.ApiBaseUrl))
+	imageMonkeyAPI.SetLabelCache(fmt.Sprintf("%simagemonkey-labels-%08x.json", src.GetCacheDirectory(), h.Sum32()), imagemonkey.DefaultLabelCacheTTL)
+	return imageMonkeyAPI
+}
+
+//checkLabels resolves the labels against the label catalogue of the server. Labels
+//the server doesn't know are remapped if possible, otherwise the push is refused
+//and the names of the source that were mapped to the label are listed. Labels that
+//don't match any object of the source are refused as well.
+func checkLabels(ctx context.Context, src source.Source, imageMonkeyAPI *imagemonkey.Client, labels []string) ([]convert.ResolvedLabel, error) {
+	catalogue, err := imageMonkeyAPI.GetLabelsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the labels of the server (use -skip-label-check to push anyway): %s", err.Error())
+	}
+
+	labelMap, err := src.Labels(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	labelMapper := src.GetLabelMapper()
+	mappedLabelMap := labelMapper.MapLabelMap(labelMap)
+
+	resolved := make([]convert.ResolvedLabel, 0, len(labels))
+	unknown, empty := false, false
+	for _, label := range labels {
+		resolvedLabel, err := convert.ResolveLabel(catalogue, labelMapper, label)
+		if err != nil {
+			unknown = true
+			names := make(map[string]int32)
+			for _, name := range labelMapper.Names(labelMap, label) {
+				names[name] = labelMap[name]
+			}
+			if len(names) > 0 {
+				fmt.Printf("%s\n  unmapped names: %s\n", err.Error(), convert.FormatLabelNames(names))
+			} else {
+				fmt.Printf("%s\n", err.Error())
+			}
+			continue
+		}
+
+		if resolvedLabel.Label != label {
+			fmt.Printf("label %s is known to the server as %s, using that one\n", label, resolvedLabel.Label)
+		}
+		if mappedLabelMap[resolvedLabel.Match] == 0 {
+			empty = true
+			fmt.Printf("label %s (matched as %s) doesn't match any object of the dataset\n", resolvedLabel.Label, resolvedLabel.Match)
+			continue
+		}
+		resolved = append(resolved, resolvedLabel)
+	}
+
+	if unknown {
+		return resolved, errors.New("refusing to push labels the server doesn't know, add them to the label mapping")
+	}
+	if empty {
+		return resolved, errors.New("refusing to push labels without images, check the spelling or the label mapping")
+	}
+	return resolved, nil
+}
+
+//splitLabels turns a comma separated list of labels into a slice
+func splitLabels(in string) []string {
+	labels := []string{}
+	for _, label := range strings.Split(in, ",") {
+		label = strings.TrimSpace(label)
+		if label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+func requireLabels(in string) ([]string, error) {
+	labels := splitLabels(in)
+	if len(labels) == 0 {
+		return labels, errors.New("no label given, use -label")
+	}
+	return labels, nil
+}
+
+func runSync(env Environment, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	addDatasetFlags(fs, &env)
+	fs.IntVar(&env.MirrorConcurrency, "concurrency", env.MirrorConcurrency, "number of parallel downloads")
+	incremental := fs.Bool("incremental", false, "fetch new and changed annotations and remove deleted ones")
+	masks := fs.Bool("masks", false, "mirror the segmentation masks as well (otherwise they are downloaded on demand)")
+	fs.Parse(args)
+
+	err := requireLabelMe(env)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext("Stopping the sync, the next sync resumes it")
+	defer stop()
+
+	if *incremental {
+		labelMeDataset, err := newDataset(env)
+		if err != nil {
+			return err
+		}
+		result, err := labelMeDataset.SyncContext(ctx)
+		printSyncReport(result)
+		if err != nil {
+			return err
+		}
+	}
+
+	labelMeDataset, err := openDataset(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	if *masks {
+		result, err := labelMeDataset.MirrorMasksContext(ctx)
+		fmt.Printf("downloaded %d, skipped %d, failed %d masks\n", len(result.Added), result.Skipped, len(result.Failed))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = labelMeDataset.BuildLabelMap()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("dataset contains %d labels\n", len(labelMeDataset.GetLabelMap()))
+	return nil
+}
+
+func printSyncReport(result labelme.MirrorResult) {
+	for _, u := range result.Added {
+		fmt.Printf("+ %s\n", u)
+	}
+	for _, u := range result.Changed {
+		fmt.Printf("~ %s\n", u)
+	}
+	for _, u := range result.Removed {
+		fmt.Printf("- %s\n", u)
+	}
+	fmt.Printf("added %d, changed %d, removed %d, unchanged %d, failed %d annotations\n",
+		len(result.Added), len(result.Changed), len(result.Removed), result.Unchanged, len(result.Failed))
+}
+
+func runIndex(env Environment, args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	addDatasetFlags(fs, &env)
+	fs.Parse(args)
+
+	labelMeDataset, err := openDataset(context.Background(), env)
+	if err != nil {
+		return err
+	}
+
+	err = labelMeDataset.Index()
+	if err != nil {
+		return err
+	}
+
+	err = labelMeDataset.BuildLabelMap()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("indexed %d labels\n", len(labelMeDataset.GetLabelMap()))
+	return nil
+}
+
+func runLabels(env Environment, args []string) error {
+	fs := flag.NewFlagSet("labels", flag.ExitOnError)
+	addDatasetFlags(fs, &env)
+	minCount := fs.Int("min", 1, "only show labels that occur at least this often")
+	raw := fs.Bool("raw", false, "show the names of the source as they are instead of the mapped ImageMonkey labels")
+	unknown := fs.Bool("unknown", false, "only show the labels the ImageMonkey server doesn't know, together with the names of the source")
+	addApiFlags(fs, &env)
+	where := addFilterFlags(fs)
+	fs.Parse(args)
+
+	ctx := context.Background()
+	src, err := openSource(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	var filter *labelme.ObjectFilter
+	if *where != "" {
+		filter, err = newObjectFilter(src, "", *where)
+		if err != nil {
+			return err
+		}
+	}
+	labelMap, err := src.Labels(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if *unknown {
+		catalogue, err := newImageMonkeyAPI(env, src).GetLabelsContext(ctx)
+		if err != nil {
+			return err
+		}
+		for _, entry := range convert.FindUnknownLabels(catalogue, src.GetLabelMapper(), labelMap) {
+			if entry.Num >= int32(*minCount) {
+				fmt.Printf("%8d %s: %s\n", entry.Num, entry.Label, convert.FormatLabelNames(entry.Names))
+			}
+		}
+		return nil
+	}
+
+	if !*raw {
+		labelMap = src.GetLabelMapper().MapLabelMap(labelMap)
+	}
+
+	names := make([]string, 0, len(labelMap))
+	for name := range labelMap {
+		names = append(names, name)
+	}
+	//most frequent labels first
+	sort.Slice(names, func(i, j int) bool {
+		if labelMap[names[i]] == labelMap[names[j]] {
+			return names[i] < names[j]
+		}
+		return labelMap[names[i]] > labelMap[names[j]]
+	})
+
+	for _, name := range names {
+		if labelMap[name] >= int32(*minCount) {
+			fmt.Printf("%8d %s\n", labelMap[name], name)
+		}
+	}
+
+	return nil
+}
+
+func runList(env Environment, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	addDatasetFlags(fs, &env)
+	label := fs.String("label", "", "comma separated list of labels")
+	folder := fs.String("folder", "", "only list images of this LabelMe folder (requires the index)")
+	attribute := fs.String("attribute", "", "only list images with objects that have this attribute (requires the index)")
+	where := addFilterFlags(fs)
+	fs.Parse(args)
+
+	if *where != "" && (*folder != "" || *attribute != "") {
+		return errors.New("-where can't be combined with -folder or -attribute")
+	}
+
+	labels := splitLabels(*label)
+	if len(labels) == 0 {
+		if *folder == "" && *attribute == "" && *where == "" {
+			return errors.New("no label given, use -label, -folder, -attribute or -where")
+		}
+		labels = []string{""}
+	}
+
+	if *folder != "" || *attribute != "" {
+		err := requireLabelMe(env)
+		if err != nil {
+			return fmt.Errorf("-folder and -attribute are %s", err.Error())
+		}
+	}
+
+	src, err := openSource(context.Background(), env)
+	if err != nil {
+		return err
+	}
+
+	for _, label := range labels {
+		var imageInfos []labelme.ImageInfo
+		if *folder != "" || *attribute != "" {
+			imageInfos, err = src.(*labelme.Dataset).QueryImageInfos(labelme.IndexQuery{Label: label, Folder: *folder, Attribute: *attribute})
+		} else {
+			var filter *labelme.ObjectFilter
+			filter, err = newObjectFilter(src, label, *where)
+			if err != nil {
+				return err
+			}
+			imageInfos, err = selectImageInfos(src, label, filter, *where)
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't get image infos for %s: %s", label, err.Error())
+		}
+
+		for _, imageInfo := range imageInfos {
+			fmt.Printf("%s\t%s\t%s\n", label, imageInfo.UniqueName, path.Join(imageInfo.Folder, imageInfo.Filename))
+		}
+	}
+
+	return nil
+}
+
+func runDownload(env Environment, args []string) error {
+	fs := flag.NewFlagSet("download", flag.ExitOnError)
+	addDatasetFlags(fs, &env)
+	label := fs.String("label", "", "comma separated list of labels")
+	fs.IntVar(&env.DownloadOptions.Parallelism, "parallel", env.DownloadOptions.Parallelism, "number of images that are downloaded in parallel")
+	fs.IntVar(&env.DownloadOptions.Retries, "retries", env.DownloadOptions.Retries, "number of retries per image")
+	where := addFilterFlags(fs)
+	fs.Parse(args)
+
+	labels, err := requireLabels(*label)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext("Stopping the download, waiting for the downloads in flight")
+	defer stop()
+
+	src, err := openSource(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	for _, label := range labels {
+		filter, err := newObjectFilter(src, label, *where)
+		if err != nil {
+			return err
+		}
+
+		imageInfos, err := selectImageInfos(src, label, filter, *where)
+		if err != nil {
+			return fmt.Errorf("couldn't get image infos for %s: %s", label, err.Error())
+		}
+
+		err = src.DownloadImagesContext(ctx, imageInfos, label)
+		if err != nil {
+			return fmt.Errorf("couldn't download images for %s: %s", label, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func runPush(env Environment, args []string) error {
+	fs := flag.NewFlagSet("push", flag.ExitOnError)
+	addDatasetFlags(fs, &env)
+	label := fs.String("label", "", "comma separated list of labels")
+	addApiFlags(fs, &env)
+	fs.BoolVar(&env.AutoUnlock, "auto-unlock", env.AutoUnlock, "unlock the donated images automatically")
+	annotations := fs.Bool("annotations", true, "add the polygons of the label to the donated images")
+	dryRun := fs.Bool("dry-run", false, "don't donate anything, write a report of what would be donated instead")
+	reportDirectory := fs.String("report-dir", "", "directory the dry run reports are written to (default: the reports directory in the cache)")
+	confirm := fs.String("confirm", "", "comma separated confirmations printed by the dry run (required if the environment has confirm_push)")
+	skipLabelCheck := fs.Bool("skip-label-check", false, "don't check the labels against the labels the server knows")
+	force := fs.Bool("force", false, "push the images again, even if the journal says they were already pushed")
+	fs.IntVar(&env.DecodeWorkers, "decode-workers", env.DecodeWorkers, "number of images that are loaded and scaled in parallel")
+	fs.IntVar(&env.UploadWorkers, "upload-workers", env.UploadWorkers, "number of images that are uploaded in parallel")
+	where := addFilterFlags(fs)
+	fs.Parse(args)
+
+	labels, err := requireLabels(*label)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext("Stopping the push, waiting for the uploads in flight")
+	defer stop()
+
+	src, err := openSource(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	imageMonkeyAPI := newImageMonkeyAPI(env, src)
+	var resolved []convert.ResolvedLabel
+	if *skipLabelCheck {
+		for _, label := range labels {
+			resolved = append(resolved, convert.UnresolvedLabel(src.GetLabelMapper(), label))
+		}
+	} else {
+		resolved, err = checkLabels(ctx, src, imageMonkeyAPI, labels)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, label := range resolved {
+		filter, err := newObjectFilter(src, label.Match, *where)
+		if err != nil {
+			return err
+		}
+
+		imageInfos, err := selectImageInfos(src, label.Match, filter, *where)
+		if err != nil {
+			return fmt.Errorf("couldn't get image infos for %s: %s", label.Label, err.Error())
+		}
+
+		err = pushLabel(ctx, src, imageMonkeyAPI, env, label.Label, imageInfos, filter, *force, convert.PushOptions{
+			AutoUnlock: env.AutoUnlock,
+			Annotations: *annotations,
+			DryRun: *dryRun,
+			ReportDirectory: *reportDirectory,
+			Environment: env.Name,
+			RequireConfirmation: env.ConfirmPush,
+			Confirmations: splitLabels(*confirm),
+			DecodeWorkers: env.DecodeWorkers,
+			UploadWorkers: env.UploadWorkers,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//interruptContext returns a context that is cancelled on the first Ctrl+C, so that
+//long running commands can stop gracefully. A second Ctrl+C terminates immediately.
+func interruptContext(message string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupts:
+			//restore the default behaviour for the next Ctrl+C
+			signal.Stop(interrupts)
+			fmt.Printf("\n%s (press Ctrl+C again to abort immediately)\n", message)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(interrupts)
+		cancel()
+	}
+}
+
+//pushLabel pushes the images of a label and records them in the journal of the environment
+func pushLabel(ctx context.Context, src source.Source, imageMonkeyAPI *imagemonkey.Client, env Environment, label string,
+	imageInfos []labelme.ImageInfo, filter *labelme.ObjectFilter, force bool, options convert.PushOptions) error {
+	if options.ReportDirectory == "" {
+		options.ReportDirectory = src.GetCacheDirectory() + "reports"
+	}
+
+	path := convert.JournalPath(src.GetCacheDirectory(), env.Name, label)
+	if force {
+		//a forced dry run ignores the journal, but leaves it intact
+		if options.DryRun {
+			return convert.Push(ctx, src, imageMonkeyAPI, label, imageInfos, filter, options)
+		}
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	journal, err := convert.OpenPushJournal(path)
+	if err != nil {
+		return fmt.Errorf("couldn't open journal: %s", err.Error())
+	}
+	defer journal.Close()
+
+	options.Journal = journal
+	return convert.Push(ctx, src, imageMonkeyAPI, label, imageInfos, filter, options)
+}
+
+func runJournal(env Environment, args []string) error {
+	fs := flag.NewFlagSet("journal", flag.ExitOnError)
+	addDatasetFlags(fs, &env)
+	label := fs.String("label", "", "only show the journal of this label")
+	all := fs.Bool("all", false, "show the journals of all environments, not only of the selected one")
+	failed := fs.Bool("failed", false, "list the images that failed")
+	fs.Parse(args)
+
+	environment := env.Name
+	if *all {
+		environment = ""
+	}
+
+	//the journals are read directly, the dataset doesn't need to be loaded
+	src, err := newSource(env)
+	if err != nil {
+		return err
+	}
+	summaries, err := convert.SummarizeJournals(src.GetCacheDirectory(), environment, *label)
+	if err != nil {
+		return err
+	}
+	if len(summaries) == 0 {
+		fmt.Printf("nothing pushed yet\n")
+		return nil
+	}
+
+	for _, summary := range summaries {
+		fmt.Printf("%s\t%s\t%s\tdone %d, duplicate %d, donated without annotations %d, failed %d\tlast push %s\n",
+			summary.Environment, summary.Label, summary.Api, summary.Counts[convert.JournalStatusDone], summary.Counts[convert.JournalStatusDuplicate],
+			summary.Counts[convert.JournalStatusDonated], summary.Counts[convert.JournalStatusFailed], summary.LastUpdate.Format(time.RFC3339))
+		if *failed {
+			for _, entry := range summary.Failed {
+				fmt.Printf("  %s\t%s\t%s\n", entry.UniqueName, entry.Status, entry.Error)
+			}
+		}
+	}
+
+	return nil
+}
+
+func runExceptions(env Environment, args []string) error {
+	usage := errors.New("usage: exceptions add|remove|list [flags]")
+	if len(args) < 1 {
+		return usage
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("exceptions " + action, flag.ExitOnError)
+	addDatasetFlags(fs, &env)
+	uniqueName := fs.String("image", "", "unique name of the image (as printed by 'list')")
+	pattern := fs.String("pattern", "", "glob pattern on <folder>/<filename>, e.g. 'somefolder/*' to exclude a whole folder")
+	reason := fs.String("reason", "", "why the images are excluded")
+	fs.Parse(args[1:])
+
+	err := requireLabelMe(env)
+	if err != nil {
+		return err
+	}
+
+	//the exceptions don't need the annotations, so the dataset isn't loaded completely
+	labelMeDataset := labelme.NewDataset(env.DatasetDirectory, env.UseCache)
+	err = labelMeDataset.LoadImageExceptions()
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "add":
+		err = labelMeDataset.AddImageException(labelme.ImageException{UniqueName: *uniqueName, Pattern: *pattern, Reason: *reason})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("added exception\n")
+	case "remove":
+		removed, err := labelMeDataset.RemoveImageException(*uniqueName, *pattern)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return errors.New("there is no such exception")
+		}
+		fmt.Printf("removed exception\n")
+	case "list":
+		for _, exception := range labelMeDataset.GetImageExceptions() {
+			if exception.Pattern != "" {
+				fmt.Printf("pattern\t%s\t%s\n", exception.Pattern, exception.Reason)
+			} else {
+				fmt.Printf("image\t%s\t%s\n", exception.UniqueName, exception.Reason)
+			}
+		}
+	default:
+		return usage
+	}
+
+	return nil
+}
+
+func runAnnotate(env Environment, args []string) error {
+	fs := flag.NewFlagSet("annotate", flag.ExitOnError)
+	addDatasetFlags(fs, &env)
+	label := fs.String("label", "", "label of the objects that should be annotated")
+	uniqueName := fs.String("image", "", "unique name of the image in the source (as printed by 'list')")
+	imageId := fs.String("image-id", "", "id of the image in ImageMonkey")
+	addApiFlags(fs, &env)
+	where := addFilterFlags(fs)
+	fs.Parse(args)
+
+	if *label == "" || *uniqueName == "" || *imageId == "" {
+		return errors.New("-label, -image and -image-id are required")
+	}
+
+	ctx := context.Background()
+	src, err := openSource(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	filter, err := newObjectFilter(src, *label, *where)
+	if err != nil {
+		return err
+	}
+
+	imageInfos, err := selectImageInfos(src, *label, filter, *where)
+	if err != nil {
+		return fmt.Errorf("couldn't get image infos for %s: %s", *label, err.Error())
+	}
+
+	for _, imageInfo := range imageInfos {
+		if imageInfo.UniqueName != *uniqueName {
+			continue
+		}
+
+		img, err := src.GetImageContext(ctx, *label, imageInfo, true)
+		if err != nil {
+			return err
+		}
+
+		annotation, err := convert.ReadAnnotationContext(ctx, src, imageInfo, filter, true)
+		if err != nil {
+			return err
+		}
+		if len(annotation.Objects) == 0 {
+			break
+		}
+
+		imageMonkeyAPI := newImageMonkeyAPI(env, src)
+		return imageMonkeyAPI.AddAnnotationsContext(ctx, *imageId, convert.FromLabelMe(*label, annotation, img.ScaleFactor))
+	}
+
+	return fmt.Errorf("image %s doesn't contain any object matching %s", *uniqueName, filter)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+	"gopkg.in/yaml.v3"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/convert"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/imagemonkey"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/source"
+)
+
+const defaultConfigPath = "config.yml"
+const defaultEnvironmentName = "local"
+
+//Profile contains the settings of a named environment. Every field is optional,
+//unset fields fall back to the "defaults" section of the config file.
+type Profile struct {
+	ApiBaseUrl string `yaml:"api_base_url"`
+	ClientId string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	Source string `yaml:"source"`
+	DatasetDirectory string `yaml:"dataset_directory"`
+	UseCache *bool `yaml:"use_cache"`
+	AutoUnlock *bool `yaml:"auto_unlock"`
+	ConfirmPush *bool `yaml:"confirm_push"`
+	MirrorConcurrency int `yaml:"mirror_concurrency"`
+	DownloadParallelism int `yaml:"download_parallelism"`
+	DownloadRetries *int `yaml:"download_retries"`
+	ParseWorkers int `yaml:"parse_workers"`
+	DecodeWorkers int `yaml:"decode_workers"`
+	UploadWorkers int `yaml:"upload_workers"`
+	IncludeDeleted *bool `yaml:"include_deleted"`
+	OnlyVerified *bool `yaml:"only_verified"`
+	LabelMappingFile string `yaml:"label_mapping"`
+	ApiTimeout time.Duration `yaml:"api_timeout"`
+	ApiRetries *int `yaml:"api_retries"`
+	ApiRequestsPerSecond float64 `yaml:"api_requests_per_second"`
+}
+
+type Config struct {
+	DefaultEnvironment string `yaml:"default_environment"`
+	Defaults Profile `yaml:"defaults"`
+	Environments map[string]Profile `yaml:"environments"`
+}
+
+//Environment contains the resolved settings the commands work with.
+//The values are layered: built-in defaults < config file defaults < named
+//environment < environment variables < command line flags.
+type Environment struct {
+	Name string
+	ApiBaseUrl string
+	ClientId string
+	ClientSecret string
+	Source string
+	DatasetDirectory string
+	UseCache bool
+	AutoUnlock bool
+	ConfirmPush bool
+	MirrorConcurrency int
+	DownloadOptions labelme.DownloadOptions
+	ParseWorkers int
+	DecodeWorkers int
+	UploadWorkers int
+	ObjectOptions labelme.ObjectOptions
+	LabelMappingFile string
+	ClientOptions imagemonkey.ClientOptions
+}
+
+func defaultEnvironment() Environment {
+	return Environment{
+		Name: defaultEnvironmentName,
+		ApiBaseUrl: "http://127.0.0.1:8081",
+		Source: source.DefaultSource,
+		DatasetDirectory: "../dataset",
+		UseCache: true,
+		AutoUnlock: false,
+		ConfirmPush: false,
+		MirrorConcurrency: labelme.DefaultMirrorConcurrency,
+		DownloadOptions: labelme.DefaultDownloadOptions(),
+		ParseWorkers: labelme.DefaultParseWorkers(),
+		DecodeWorkers: convert.DefaultDecodeWorkers(),
+		UploadWorkers: convert.DefaultUploadWorkers,
+		ObjectOptions: labelme.DefaultObjectOptions(),
+		ClientOptions: imagemonkey.DefaultClientOptions(),
+	}
+}
+
+func readConfig(path string) (Config, error) {
+	var config Config
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	err = yaml.Unmarshal(bytes, &config)
+	if err != nil {
+		return config, fmt.Errorf("couldn't parse config %s: %s", path, err.Error())
+	}
+
+	return config, nil
+}
+
+func (p Profile) applyTo(env *Environment) {
+	if p.ApiBaseUrl != "" {
+		env.ApiBaseUrl = p.ApiBaseUrl
+	}
+	if p.ClientId != "" {
+		env.ClientId = p.ClientId
+	}
+	if p.ClientSecret != "" {
+		env.ClientSecret = p.ClientSecret
+	}
+	if p.Source != "" {
+		env.Source = p.Source
+	}
+	if p.DatasetDirectory != "" {
+		env.DatasetDirectory = p.DatasetDirectory
+	}
+	if p.UseCache != nil {
+		env.UseCache = *p.UseCache
+	}
+	if p.AutoUnlock != nil {
+		env.AutoUnlock = *p.AutoUnlock
+	}
+	if p.ConfirmPush != nil {
+		env.ConfirmPush = *p.ConfirmPush
+	}
+	if p.MirrorConcurrency > 0 {
+		env.MirrorConcurrency = p.MirrorConcurrency
+	}
+	if p.DownloadParallelism > 0 {
+		env.DownloadOptions.Parallelism = p.DownloadParallelism
+	}
+	if p.DownloadRetries != nil {
+		env.DownloadOptions.Retries = *p.DownloadRetries
+	}
+	if p.ParseWorkers > 0 {
+		env.ParseWorkers = p.ParseWorkers
+	}
+	if p.DecodeWorkers > 0 {
+		env.DecodeWorkers = p.DecodeWorkers
+	}
+	if p.UploadWorkers > 0 {
+		env.UploadWorkers = p.UploadWorkers
+	}
+	if p.IncludeDeleted != nil {
+		env.ObjectOptions.IncludeDeleted = *p.IncludeDeleted
+	}
+	if p.OnlyVerified != nil {
+		env.ObjectOptions.OnlyVerified = *p.OnlyVerified
+	}
+	if p.LabelMappingFile != "" {
+		env.LabelMappingFile = p.LabelMappingFile
+	}
+	if p.ApiTimeout > 0 {
+		env.ClientOptions.Timeout = p.ApiTimeout
+	}
+	if p.ApiRetries != nil {
+		env.ClientOptions.Retries = *p.ApiRetries
+	}
+	if p.ApiRequestsPerSecond > 0 {
+		env.ClientOptions.RequestsPerSecond = p.ApiRequestsPerSecond
+	}
+}
+
+func (p Config) environmentNames() []string {
+	names := make([]string, 0, len(p.Environments))
+	for name := range p.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupBoolEnv(key string, value *bool) error {
+	if s, ok := os.LookupEnv(key); ok && s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %s", key, s)
+		}
+		*value = b
+	}
+	return nil
+}
+
+func lookupStringEnv(key string, value *string) {
+	if s, ok := os.LookupEnv(key); ok && s != "" {
+		*value = s
+	}
+}
+
+//loadEnvironment resolves the settings of the environment with the given name.
+//An empty configPath means that the default config file is used, if it exists.
+//An empty name selects the default environment of the config file.
+func loadEnvironment(configPath string, name string) (Environment, error) {
+	env := defaultEnvironment()
+
+	//the -config and -env flags take precedence over the environment variables
+	if configPath == "" {
+		lookupStringEnv("IMAGEMONKEY_CONFIG", &configPath)
+	}
+	if name == "" {
+		lookupStringEnv("IMAGEMONKEY_ENV", &name)
+	}
+
+	var config Config
+	if configPath != "" {
+		var err error
+		config, err = readConfig(configPath)
+		if err != nil {
+			return env, err
+		}
+	} else if _, err := os.Stat(defaultConfigPath); err == nil {
+		config, err = readConfig(defaultConfigPath)
+		if err != nil {
+			return env, err
+		}
+	}
+
+	if name == "" {
+		name = config.DefaultEnvironment
+	}
+	if name == "" {
+		name = defaultEnvironmentName
+	}
+	env.Name = name
+
+	config.Defaults.applyTo(&env)
+	if profile, ok := config.Environments[name]; ok {
+		profile.applyTo(&env)
+	} else if name != defaultEnvironmentName {
+		if len(config.Environments) == 0 {
+			return env, errors.New("unknown environment " + name + " (no environments configured)")
+		}
+		return env, fmt.Errorf("unknown environment %s (available: %v)", name, config.environmentNames())
+	}
+
+	lookupStringEnv("IMAGEMONKEY_API_URL", &env.ApiBaseUrl)
+	lookupStringEnv("IMAGEMONKEY_CLIENT_ID", &env.ClientId)
+	lookupStringEnv("IMAGEMONKEY_CLIENT_SECRET", &env.ClientSecret)
+	lookupStringEnv("IMAGEMONKEY_SOURCE", &env.Source)
+	lookupStringEnv("IMAGEMONKEY_DATASET_DIR", &env.DatasetDirectory)
+	lookupStringEnv("IMAGEMONKEY_LABEL_MAPPING", &env.LabelMappingFile)
+	err := lookupBoolEnv("IMAGEMONKEY_USE_CACHE", &env.UseCache)
+	if err != nil {
+		return env, err
+	}
+	err = lookupBoolEnv("IMAGEMONKEY_AUTO_UNLOCK", &env.AutoUnlock)
+	if err != nil {
+		return env, err
+	}
+	err = lookupBoolEnv("IMAGEMONKEY_CONFIRM_PUSH", &env.ConfirmPush)
+	if err != nil {
+		return env, err
+	}
+
+	return env, nil
+}
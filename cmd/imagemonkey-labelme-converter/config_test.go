@@ -0,0 +1,229 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+default_environment: staging
+defaults:
+  api_base_url: http://defaults.invalid
+  dataset_directory: /data/labelme
+  parse_workers: 3
+  api_retries: 5
+environments:
+  staging:
+    api_base_url: http://staging.invalid
+    client_id: staging-id
+    use_cache: false
+  production:
+    api_base_url: https://production.invalid
+    client_id: production-id
+    source: voc
+    confirm_push: true
+    api_retries: 0
+    api_timeout: 10s
+    include_deleted: true
+`
+
+//clearEnvironmentVariables unsets the variables loadEnvironment reads, so that the
+//environment of the test run doesn't leak into the tests
+func clearEnvironmentVariables(t *testing.T) {
+	for _, key := range []string{
+		"IMAGEMONKEY_CONFIG", "IMAGEMONKEY_ENV", "IMAGEMONKEY_API_URL", "IMAGEMONKEY_CLIENT_ID",
+		"IMAGEMONKEY_CLIENT_SECRET", "IMAGEMONKEY_SOURCE", "IMAGEMONKEY_DATASET_DIR",
+		"IMAGEMONKEY_LABEL_MAPPING", "IMAGEMONKEY_USE_CACHE", "IMAGEMONKEY_AUTO_UNLOCK",
+		"IMAGEMONKEY_CONFIRM_PUSH",
+	} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	err := ioutil.WriteFile(configPath, []byte(testConfig), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := defaultEnvironment()
+
+	tests := []struct {
+		name string
+		configPath string
+		envName string
+		variables map[string]string
+		check func(env Environment) bool
+		//part of the error message, empty if loading has to succeed
+		err string
+	}{
+		{
+			name: "built-in defaults without config",
+			check: func(env Environment) bool {
+				return env.Name == defaultEnvironmentName && env.ApiBaseUrl == defaults.ApiBaseUrl &&
+					env.Source == "labelme" && env.UseCache && env.ClientOptions.Retries == defaults.ClientOptions.Retries
+			},
+		},
+		{
+			name: "default environment of the config",
+			configPath: configPath,
+			check: func(env Environment) bool {
+				return env.Name == "staging" && env.ApiBaseUrl == "http://staging.invalid" && env.ClientId == "staging-id"
+			},
+		},
+		{
+			name: "config defaults below the environment",
+			configPath: configPath,
+			check: func(env Environment) bool {
+				return env.DatasetDirectory == "/data/labelme" && env.ParseWorkers == 3 && env.ClientOptions.Retries == 5
+			},
+		},
+		{
+			name: "false overrides a true default",
+			configPath: configPath,
+			check: func(env Environment) bool {
+				return !env.UseCache
+			},
+		},
+		{
+			name: "named environment",
+			configPath: configPath,
+			envName: "production",
+			check: func(env Environment) bool {
+				return env.Name == "production" && env.ApiBaseUrl == "https://production.invalid" && env.Source == "voc" &&
+					env.ConfirmPush && env.UseCache && env.ObjectOptions.IncludeDeleted &&
+					env.ClientOptions.Retries == 0 && env.ClientOptions.Timeout == 10*time.Second
+			},
+		},
+		{
+			name: "environment selected by variable",
+			configPath: configPath,
+			variables: map[string]string{"IMAGEMONKEY_ENV": "production"},
+			check: func(env Environment) bool {
+				return env.Name == "production"
+			},
+		},
+		{
+			name: "name takes precedence over the variable",
+			configPath: configPath,
+			envName: "staging",
+			variables: map[string]string{"IMAGEMONKEY_ENV": "production"},
+			check: func(env Environment) bool {
+				return env.Name == "staging"
+			},
+		},
+		{
+			name: "config selected by variable",
+			variables: map[string]string{"IMAGEMONKEY_CONFIG": configPath},
+			check: func(env Environment) bool {
+				return env.Name == "staging"
+			},
+		},
+		{
+			name: "variables above the environment",
+			configPath: configPath,
+			envName: "production",
+			variables: map[string]string{
+				"IMAGEMONKEY_API_URL": "http://variable.invalid",
+				"IMAGEMONKEY_SOURCE": "coco",
+				"IMAGEMONKEY_CONFIRM_PUSH": "false",
+			},
+			check: func(env Environment) bool {
+				return env.ApiBaseUrl == "http://variable.invalid" && env.Source == "coco" && !env.ConfirmPush &&
+					env.ClientId == "production-id"
+			},
+		},
+		{
+			name: "unknown environment",
+			configPath: configPath,
+			envName: "testing",
+			err: "unknown environment testing (available: [production staging])",
+		},
+		{
+			name: "unknown environment without config",
+			envName: "testing",
+			err: "no environments configured",
+		},
+		{
+			name: "invalid boolean variable",
+			variables: map[string]string{"IMAGEMONKEY_USE_CACHE": "maybe"},
+			err: "invalid value for IMAGEMONKEY_USE_CACHE",
+		},
+		{
+			name: "missing config",
+			configPath: filepath.Join(t.TempDir(), "missing.yml"),
+			err: "missing.yml",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnvironmentVariables(t)
+			for key, value := range test.variables {
+				t.Setenv(key, value)
+			}
+
+			env, err := loadEnvironment(test.configPath, test.envName)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadEnvironment failed: %s", err.Error())
+			}
+			if !test.check(env) {
+				t.Errorf("unexpected environment %+v", env)
+			}
+		})
+	}
+}
+
+func TestDatasetFlagsOverrideEnvironment(t *testing.T) {
+	tests := []struct {
+		args []string
+		check func(env Environment) bool
+	}{
+		{
+			args: nil,
+			check: func(env Environment) bool {
+				return env.Source == "voc" && env.DatasetDirectory == "/data/voc" && !env.UseCache
+			},
+		},
+		{
+			args: []string{"-source", "coco", "-dataset", "/data/coco"},
+			check: func(env Environment) bool {
+				return env.Source == "coco" && env.DatasetDirectory == "/data/coco" && !env.UseCache
+			},
+		},
+		{
+			args: []string{"-cache", "-include-deleted", "-parse-workers", "7"},
+			check: func(env Environment) bool {
+				return env.UseCache && env.ObjectOptions.IncludeDeleted && env.ParseWorkers == 7
+			},
+		},
+	}
+
+	for _, test := range tests {
+		env := defaultEnvironment()
+		env.Source = "voc"
+		env.DatasetDirectory = "/data/voc"
+		env.UseCache = false
+
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		addDatasetFlags(fs, &env)
+		err := fs.Parse(test.args)
+		if err != nil {
+			t.Errorf("%v: %s", test.args, err.Error())
+			continue
+		}
+		if !test.check(env) {
+			t.Errorf("%v: unexpected environment %+v", test.args, env)
+		}
+	}
+}
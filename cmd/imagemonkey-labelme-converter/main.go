@@ -0,0 +1,76 @@
+//Command imagemonkey-labelme-converter downloads the LabelMe dataset and donates its
+//images to ImageMonkey.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+type Command struct {
+	Name string
+	Description string
+	Run func(env Environment, args []string) error
+}
+
+var commands = []Command{
+	{Name: "sync", Description: "download the LabelMe annotations and build the label map", Run: runSync},
+	{Name: "index", Description: "parse all annotations into the index that speeds up labels and list", Run: runIndex},
+	{Name: "labels", Description: "list all labels of the dataset together with their occurrences", Run: runLabels},
+	{Name: "list", Description: "list the images that contain the given label(s)", Run: runList},
+	{Name: "download", Description: "download the images that contain the given label(s)", Run: runDownload},
+	{Name: "push", Description: "donate the downloaded images to ImageMonkey", Run: runPush},
+	{Name: "journal", Description: "show what was pushed to which environment", Run: runJournal},
+	{Name: "exceptions", Description: "add, remove or list images that are never listed, downloaded or pushed", Run: runExceptions},
+	{Name: "annotate", Description: "add the LabelMe polygons of an image to an ImageMonkey image", Run: runAnnotate},
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [-config file] [-env name] <command> [flags]\n\nflags:\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\ncommands:\n")
+	for _, command := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", command.Name, command.Description)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun '%s <command> -h' to see the flags of a command\n", os.Args[0])
+}
+
+func main() {
+	configPath := flag.String("config", "", "path to the config file (default \""+defaultConfigPath+"\" if it exists, or $IMAGEMONKEY_CONFIG)")
+	envName := flag.String("env", "", "name of the environment in the config file (or $IMAGEMONKEY_ENV)")
+	flag.Usage = printUsage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	if name == "help" {
+		printUsage()
+		return
+	}
+
+	for _, command := range commands {
+		if command.Name == name {
+			env, err := loadEnvironment(*configPath, *envName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Couldn't load config: %s\n", err.Error())
+				os.Exit(1)
+			}
+
+			err = command.Run(env, flag.Args()[1:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", name, err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Invalid command: %s\n\n", name)
+	printUsage()
+	os.Exit(2)
+}
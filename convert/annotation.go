@@ -0,0 +1,38 @@
+package convert
+
+import (
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/imagemonkey"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+)
+
+//FromLabelMe converts the polygons of the LabelMe annotation into an ImageMonkey annotation
+//with the given label. The points are scaled with scaleFactor (the scale factor of the
+//donated image).
+func FromLabelMe(label string, annotation labelme.Annotation, scaleFactor float32) imagemonkey.Annotation {
+    var imagemonkeyAnnotations []imagemonkey.PolygonAnnotation
+    for _, object := range annotation.Objects {
+        //objects without a usable polygon (e.g. brush annotations whose mask wasn't resolved) are skipped
+        for _, polygon := range object.Polygons() {
+            var imagemonkeyAnnotation imagemonkey.PolygonAnnotation
+            imagemonkeyAnnotation.Type = "polygon"
+            imagemonkeyAnnotation.Angle = 0
+            imagemonkeyAnnotation.Points = make([]imagemonkey.PolyPoint, 0) //empty slice
+
+            for _, point := range polygon.Points {
+                var imagemonkeyPoint imagemonkey.PolyPoint
+                imagemonkeyPoint.X = int32(float32(point.X) * scaleFactor)
+                imagemonkeyPoint.Y= int32(float32(point.Y) * scaleFactor)
+
+                imagemonkeyAnnotation.Points = append(imagemonkeyAnnotation.Points, imagemonkeyPoint)
+            }
+
+            imagemonkeyAnnotations = append(imagemonkeyAnnotations, imagemonkeyAnnotation)
+        }
+    }
+
+    var anno imagemonkey.Annotation
+    anno.Annotations = imagemonkeyAnnotations
+    anno.Label = label
+
+    return anno
+}
\ No newline at end of file
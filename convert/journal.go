@@ -0,0 +1,223 @@
+package convert
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//the image and its annotations were donated
+	JournalStatusDone = "done"
+	//the image was donated, but its annotations couldn't be added
+	JournalStatusDonated = "donated"
+	//the image couldn't be donated
+	JournalStatusFailed = "failed"
+	//ImageMonkey already has the image
+	JournalStatusDuplicate = "duplicate"
+)
+
+//JournalEntry records the outcome of pushing a single image
+type JournalEntry struct {
+	UniqueName string `json:"uniquename"`
+	Status string `json:"status"`
+	ImageId string `json:"image_id,omitempty"`
+	Api string `json:"api"`
+	Time time.Time `json:"time"`
+	Error string `json:"error,omitempty"`
+}
+
+//PushJournal is an append-only log (one json object per line) of the images pushed
+//with a label to an environment. When an image is pushed several times, the last
+//entry wins.
+type PushJournal struct {
+	path string
+	file *os.File
+	mutex sync.Mutex
+	entries map[string]JournalEntry
+}
+
+//JournalPath returns the path of the journal of the given environment and label
+func JournalPath(cacheDirectory string, environment string, label string) string {
+	return filepath.Join(cacheDirectory, "journal", environment, strings.Replace(label, "/", "_", -1) + ".jsonl")
+}
+
+func readJournalEntries(path string) (map[string]JournalEntry, error) {
+	entries := make(map[string]JournalEntry)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return entries, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry JournalEntry
+		//a crash while writing can leave a truncated last line, skip it
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries[entry.UniqueName] = entry
+	}
+	return entries, scanner.Err()
+}
+
+//terminateLastLine appends a newline to f if the file at path doesn't end with one
+func terminateLastLine(path string, f *os.File) error {
+	r, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	info, err := r.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	_, err = r.ReadAt(last, info.Size() - 1)
+	if err != nil || last[0] == '\n' {
+		return err
+	}
+	_, err = f.Write([]byte{'\n'})
+	return err
+}
+
+func OpenPushJournal(path string) (*PushJournal, error) {
+	entries, err := readJournalEntries(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	//terminate a truncated last line, otherwise the next entry would be appended to it
+	err = terminateLastLine(path, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &PushJournal{path: path, file: f, entries: entries}, nil
+}
+
+//Get returns the last entry of the image
+func (p *PushJournal) Get(uniqueName string) (JournalEntry, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	entry, ok := p.entries[uniqueName]
+	return entry, ok
+}
+
+//Record appends the entry to the journal. The entry is synced to disk, so that it
+//survives a crash right afterwards.
+func (p *PushJournal) Record(entry JournalEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	_, err = p.file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	p.entries[entry.UniqueName] = entry
+	return p.file.Sync()
+}
+
+func (p *PushJournal) Close() error {
+	return p.file.Close()
+}
+
+//JournalSummary counts the images per status of a journal
+type JournalSummary struct {
+	Environment string
+	Label string
+	Api string
+	Counts map[string]int
+	LastUpdate time.Time
+	Failed []JournalEntry
+}
+
+//SummarizeJournals summarizes all journals in the cache directory, optionally
+//restricted to an environment and/or label
+func SummarizeJournals(cacheDirectory string, environment string, label string) ([]JournalSummary, error) {
+	var summaries []JournalSummary
+
+	dir := filepath.Join(cacheDirectory, "journal")
+	environments, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return summaries, nil
+	}
+	if err != nil {
+		return summaries, err
+	}
+
+	for _, env := range environments {
+		if !env.IsDir() || (environment != "" && env.Name() != environment) {
+			continue
+		}
+
+		files, err := filepath.Glob(filepath.Join(dir, env.Name(), "*.jsonl"))
+		if err != nil {
+			return summaries, err
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			name := strings.TrimSuffix(filepath.Base(file), ".jsonl")
+			if label != "" && name != strings.Replace(label, "/", "_", -1) {
+				continue
+			}
+
+			entries, err := readJournalEntries(file)
+			if err != nil {
+				return summaries, fmt.Errorf("couldn't read journal %s: %s", file, err.Error())
+			}
+
+			summary := JournalSummary{Environment: env.Name(), Label: name, Counts: make(map[string]int)}
+			for _, entry := range entries {
+				summary.Counts[entry.Status]++
+				if entry.Time.After(summary.LastUpdate) {
+					summary.LastUpdate = entry.Time
+					summary.Api = entry.Api
+				}
+				if entry.Status == JournalStatusFailed || entry.Status == JournalStatusDonated {
+					summary.Failed = append(summary.Failed, entry)
+				}
+			}
+			sort.Slice(summary.Failed, func(i, j int) bool {
+				return summary.Failed[i].UniqueName < summary.Failed[j].UniqueName
+			})
+			summaries = append(summaries, summary)
+		}
+	}
+
+	return summaries, nil
+}
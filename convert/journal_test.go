@@ -0,0 +1,136 @@
+package convert
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+)
+
+func TestPushJournalTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "car.jsonl")
+	journal := openTestJournal(t, path)
+	for _, entry := range []JournalEntry{
+		{UniqueName: "a.jpg", Status: JournalStatusDone, ImageId: "id-a"},
+		{UniqueName: "b.jpg", Status: JournalStatusFailed, Error: "timeout"},
+	} {
+		if err := journal.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal.Close()
+
+	//a crash while writing the entry of c.jpg
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"uniquename":"c.jpg","sta`)
+	f.Close()
+
+	journal = openTestJournal(t, path)
+	if entry, ok := journal.Get("a.jpg"); !ok || entry.Status != JournalStatusDone || entry.ImageId != "id-a" {
+		t.Errorf("got entry %+v of a.jpg, want the done entry", entry)
+	}
+	if _, ok := journal.Get("c.jpg"); ok {
+		t.Errorf("the truncated entry of c.jpg was read")
+	}
+
+	//the entries recorded after the truncated line survive the next open
+	err = journal.Record(JournalEntry{UniqueName: "c.jpg", Status: JournalStatusDuplicate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+	journal = openTestJournal(t, path)
+	if entry, ok := journal.Get("c.jpg"); !ok || entry.Status != JournalStatusDuplicate {
+		t.Errorf("got entry %+v of c.jpg after reopening, want the duplicate entry", entry)
+	}
+}
+
+func TestPushJournalLastEntryWins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "car.jsonl")
+	journal := openTestJournal(t, path)
+	for _, status := range []string{JournalStatusFailed, JournalStatusDonated, JournalStatusDone} {
+		if err := journal.Record(JournalEntry{UniqueName: "a.jpg", Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal.Close()
+
+	journal = openTestJournal(t, path)
+	if entry, _ := journal.Get("a.jpg"); entry.Status != JournalStatusDone {
+		t.Errorf("got status %s after reopening, want %s", entry.Status, JournalStatusDone)
+	}
+}
+
+func TestPendingImagesSkipsPushedImages(t *testing.T) {
+	journal := openTestJournal(t, filepath.Join(t.TempDir(), "car.jsonl"))
+	for _, entry := range []JournalEntry{
+		{UniqueName: "done.jpg", Status: JournalStatusDone, ImageId: "id-done"},
+		{UniqueName: "duplicate.jpg", Status: JournalStatusDuplicate},
+		{UniqueName: "donated.jpg", Status: JournalStatusDonated, ImageId: "id-donated"},
+		{UniqueName: "failed.jpg", Status: JournalStatusFailed},
+	} {
+		if err := journal.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var imageInfos []labelme.ImageInfo
+	for _, name := range []string{"done.jpg", "duplicate.jpg", "donated.jpg", "failed.jpg", "new.jpg"} {
+		imageInfos = append(imageInfos, labelme.ImageInfo{UniqueName: name})
+	}
+
+	pending, numExcluded, numSkipped := pendingImages(nil, imageInfos, journal)
+	var names []string
+	for _, imageInfo := range pending {
+		names = append(names, imageInfo.UniqueName)
+	}
+	if want := []string{"donated.jpg", "failed.jpg", "new.jpg"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got pending images %v, want %v", names, want)
+	}
+	if numExcluded != 0 || numSkipped != 2 {
+		t.Errorf("got %d excluded and %d skipped images, want 0 and 2", numExcluded, numSkipped)
+	}
+}
+
+func TestPushPipelineResume(t *testing.T) {
+	api := newFakeImageMonkey(t, func(r *http.Request) string { return "id-new" })
+	journal := openTestJournal(t, filepath.Join(t.TempDir(), "car.jsonl"))
+	for _, entry := range []JournalEntry{
+		{UniqueName: "donated.jpg", Status: JournalStatusDonated, ImageId: "id-donated", Error: "timeout"},
+		{UniqueName: "failed.jpg", Status: JournalStatusFailed, Error: "timeout"},
+	} {
+		if err := journal.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pipeline := &pushPipeline{imageMonkeyAPI: api.client(), label: "car", options: PushOptions{Annotations: true, Journal: journal}}
+
+	//the donated image only gets its annotations
+	result := pipeline.upload(context.Background(), newDecodedImage(0, "donated.jpg"))
+	pipeline.record(result.entry)
+	donations, annotated := api.counts()
+	if result.status != JournalStatusDone || donations != 0 || !reflect.DeepEqual(annotated, []string{"id-donated"}) {
+		t.Errorf("donated image: got status %s, %d donations and annotations %v, want only the annotations of id-donated", result.status, donations, annotated)
+	}
+
+	//the failed image is donated again
+	result = pipeline.upload(context.Background(), newDecodedImage(1, "failed.jpg"))
+	pipeline.record(result.entry)
+	donations, annotated = api.counts()
+	if result.status != JournalStatusDone || donations != 1 || !reflect.DeepEqual(annotated, []string{"id-donated", "id-new"}) {
+		t.Errorf("failed image: got status %s, %d donations and annotations %v, want a donation and the annotations of id-new", result.status, donations, annotated)
+	}
+
+	for name, id := range map[string]string{"donated.jpg": "id-donated", "failed.jpg": "id-new"} {
+		if entry, _ := journal.Get(name); entry.Status != JournalStatusDone || entry.ImageId != id {
+			t.Errorf("got journal entry %+v of %s, want done with id %s", entry, name, id)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/imagemonkey"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+)
+
+//ResolvedLabel is a label that was resolved against the label catalogue of the server
+type ResolvedLabel struct {
+	//spelling of the catalogue, used for the API calls
+	Label string
+	//normalized form the objects of the dataset are matched against
+	Match string
+}
+
+//ResolveLabel returns the label of the catalogue the given label corresponds to.
+//Labels the server doesn't know are remapped if exactly one label of the catalogue
+//has the same normalized form. A sublabel (label/sublabel) has to be listed as
+//sublabel of its (resolved) parent.
+func ResolveLabel(catalogue *imagemonkey.LabelCatalogue, labelMapper *labelme.LabelMapper, label string) (ResolvedLabel, error) {
+	if parent, sublabel, ok := strings.Cut(label, "/"); ok {
+		resolvedParent, err := ResolveLabel(catalogue, labelMapper, parent)
+		if err != nil {
+			return ResolvedLabel{}, err
+		}
+		if !catalogue.ContainsSublabel(resolvedParent.Label, sublabel) {
+			return ResolvedLabel{}, errors.New("label " + label + " is unknown to the server, " + resolvedParent.Label + " has no sublabel " + sublabel)
+		}
+		resolved := resolvedParent.Label + "/" + sublabel
+		return ResolvedLabel{Label: resolved, Match: labelMapper.MapLabel(resolved)}, nil
+	}
+
+	if catalogue.Contains(label) {
+		return ResolvedLabel{Label: label, Match: labelMapper.MapLabel(label)}, nil
+	}
+
+	normalized := labelMapper.NormalizeLabel(label)
+	var candidates []string
+	for _, name := range catalogue.Names() {
+		if labelMapper.NormalizeLabel(name) == normalized {
+			candidates = append(candidates, name)
+		}
+	}
+
+	if len(candidates) == 1 {
+		return ResolvedLabel{Label: candidates[0], Match: labelMapper.MapLabel(candidates[0])}, nil
+	}
+	if len(candidates) > 1 {
+		return ResolvedLabel{}, fmt.Errorf("label %s is ambiguous, it could be any of %s", label, strings.Join(candidates, ", "))
+	}
+	return ResolvedLabel{}, errors.New("label " + label + " is unknown to the server")
+}
+
+//UnresolvedLabel is used when the labels aren't checked against the catalogue, the
+//label is passed to the API as given
+func UnresolvedLabel(labelMapper *labelme.LabelMapper, label string) ResolvedLabel {
+	return ResolvedLabel{Label: label, Match: labelMapper.MapLabel(label)}
+}
+
+//UnknownLabel is a label of the dataset the server doesn't know, together with the
+//LabelMe names that are mapped to it
+type UnknownLabel struct {
+	Label string
+	Num int32
+	Names map[string]int32
+}
+
+//FindUnknownLabels returns the mapped labels of the label map that aren't part of the
+//catalogue, most frequent labels first
+func FindUnknownLabels(catalogue *imagemonkey.LabelCatalogue, labelMapper *labelme.LabelMapper, labelMap map[string]int32) []UnknownLabel {
+	unknown := make(map[string]*UnknownLabel)
+	for name, num := range labelMap {
+		label := labelMapper.MapLabel(name)
+		if catalogue.Contains(label) {
+			continue
+		}
+
+		entry, ok := unknown[label]
+		if !ok {
+			entry = &UnknownLabel{Label: label, Names: make(map[string]int32)}
+			unknown[label] = entry
+		}
+		entry.Num += num
+		entry.Names[name] += num
+	}
+
+	unknownLabels := make([]UnknownLabel, 0, len(unknown))
+	for _, entry := range unknown {
+		unknownLabels = append(unknownLabels, *entry)
+	}
+	sort.Slice(unknownLabels, func(i, j int) bool {
+		if unknownLabels[i].Num == unknownLabels[j].Num {
+			return unknownLabels[i].Label < unknownLabels[j].Label
+		}
+		return unknownLabels[i].Num > unknownLabels[j].Num
+	})
+	return unknownLabels
+}
+
+//FormatLabelNames formats the LabelMe names with their counts, e.g. "carside (12), cars (3)"
+func FormatLabelNames(names map[string]int32) string {
+	keys := make([]string, 0, len(names))
+	for name := range names {
+		keys = append(keys, name)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if names[keys[i]] == names[keys[j]] {
+			return keys[i] < keys[j]
+		}
+		return names[keys[i]] > names[keys[j]]
+	})
+
+	parts := make([]string, len(keys))
+	for i, name := range keys {
+		parts[i] = fmt.Sprintf("%s (%d)", strings.TrimSpace(name), names[name])
+	}
+	return strings.Join(parts, ", ")
+}
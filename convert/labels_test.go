@@ -0,0 +1,52 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/imagemonkey"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+)
+
+func TestResolveLabel(t *testing.T) {
+	catalogue := &imagemonkey.LabelCatalogue{Labels: map[string][]string{
+		"car": {"wheel", "window"},
+		"Dog": nil,
+		"person": nil,
+		"Person": nil,
+	}}
+	mapper := labelme.DefaultLabelMapper()
+
+	tests := []struct {
+		label string
+		want string
+		//part of the error message, empty if the label has to be resolved
+		err string
+	}{
+		{label: "car", want: "car"},
+		{label: "dogs", want: "Dog"},
+		{label: "car/wheel", want: "car/wheel"},
+		{label: "cars/window", want: "car/window"},
+		{label: "car/door", err: "car has no sublabel door"},
+		{label: "horse/leg", err: "label horse is unknown"},
+		{label: "Dog/tail", err: "Dog has no sublabel tail"},
+		{label: "persons", err: "ambiguous"},
+		{label: "horse", err: "unknown to the server"},
+	}
+
+	for _, test := range tests {
+		resolved, err := ResolveLabel(catalogue, mapper, test.label)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ResolveLabel(%q): got error %v, want %q", test.label, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ResolveLabel(%q) failed: %s", test.label, err.Error())
+			continue
+		}
+		if resolved.Label != test.want {
+			t.Errorf("ResolveLabel(%q) = %q, want %q", test.label, resolved.Label, test.want)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package convert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/imagemonkey"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/source"
+)
+
+const DefaultUploadWorkers = 4
+
+func DefaultDecodeWorkers() int {
+	return runtime.NumCPU()
+}
+
+//decodedImage is an image that was loaded, scaled and whose annotation was prepared
+type decodedImage struct {
+	index int
+	imageInfo labelme.ImageInfo
+	img labelme.Image
+	annotation labelme.Annotation
+	err error
+}
+
+//pushResult is the outcome of pushing a single image
+type pushResult struct {
+	index int
+	uniqueName string
+	status string
+	message string
+	entry JournalEntry
+}
+
+//pushPipeline pushes the images in two stages: the decode workers load, scale and
+//validate the images, the upload workers donate them. At most DecodeWorkers +
+//2 * UploadWorkers decoded images are kept in memory.
+type pushPipeline struct {
+	src source.Source
+	imageMonkeyAPI *imagemonkey.Client
+	label string
+	filter *labelme.ObjectFilter
+	options PushOptions
+
+	cancel context.CancelFunc
+	mutex sync.Mutex
+	err error
+}
+
+//fail stops the pipeline because of an error that affects all images (e.g. invalid credentials)
+func (p *pushPipeline) fail(err error) {
+	p.mutex.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.mutex.Unlock()
+	p.cancel()
+}
+
+func (p *pushPipeline) record(entry JournalEntry) {
+	if p.options.Journal == nil {
+		return
+	}
+	entry.Api = p.imageMonkeyAPI.BaseUrl()
+	err := p.options.Journal.Record(entry)
+	if err != nil {
+		fmt.Printf("Couldn't write journal: %s\n", err.Error())
+	}
+}
+
+//run pushes the images until all of them are pushed or the context is cancelled.
+//Uploads that are in flight when the context is cancelled are finished, images that
+//weren't uploaded yet are left for the next push.
+func (p *pushPipeline) run(ctx context.Context, pending []labelme.ImageInfo, progress *pushProgress) error {
+	//uploads in flight are finished when the push stops, so they don't get cancelled
+	uploadCtx := context.WithoutCancel(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	p.cancel = cancel
+
+	decodeWorkers := p.options.DecodeWorkers
+	if decodeWorkers < 1 {
+		decodeWorkers = 1
+	}
+	uploadWorkers := p.options.UploadWorkers
+	if uploadWorkers < 1 {
+		uploadWorkers = 1
+	}
+
+	jobs := make(chan decodedImage)
+	decoded := make(chan decodedImage, uploadWorkers)
+	results := make(chan pushResult, uploadWorkers)
+
+	go func() {
+		defer close(jobs)
+		for i, elem := range pending {
+			select {
+			case jobs <- decodedImage{index: i, imageInfo: elem}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var decodeWg sync.WaitGroup
+	for i := 0; i < decodeWorkers; i++ {
+		decodeWg.Add(1)
+		go func() {
+			defer decodeWg.Done()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				item, ok := p.decode(ctx, job)
+				if !ok {
+					continue
+				}
+				select {
+				case decoded <- item:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	go func() {
+		decodeWg.Wait()
+		close(decoded)
+	}()
+
+	var uploadWg sync.WaitGroup
+	for i := 0; i < uploadWorkers; i++ {
+		uploadWg.Add(1)
+		go func() {
+			defer uploadWg.Done()
+			for item := range decoded {
+				//decoded images that weren't uploaded yet are dropped once the push stops
+				if ctx.Err() != nil {
+					continue
+				}
+				results <- p.upload(uploadCtx, item)
+			}
+		}()
+	}
+	go func() {
+		uploadWg.Wait()
+		close(results)
+	}()
+
+	progress.record = p.record
+	progress.report(results)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.err
+}
+
+//decode loads and scales the image and prepares its annotation. Images that can't be
+//loaded stop the push, as the cache of the label is incomplete then.
+func (p *pushPipeline) decode(ctx context.Context, item decodedImage) (decodedImage, bool) {
+	var err error
+	item.img, err = p.src.GetImageContext(ctx, p.label, item.imageInfo, true)
+	if err != nil {
+		if ctx.Err() != nil {
+			return item, false
+		}
+		p.record(JournalEntry{UniqueName: item.imageInfo.UniqueName, Status: JournalStatusFailed, Error: err.Error()})
+		p.fail(err)
+		return item, false
+	}
+
+	item.annotation, item.err = prepareAnnotation(ctx, p.src, item.imageInfo, item.img, p.filter, p.options)
+	return item, true
+}
+
+//upload donates the image and adds its annotations. The journal entry is recorded
+//by the progress, so that the entries are written in the order of the images.
+func (p *pushPipeline) upload(ctx context.Context, item decodedImage) pushResult {
+	uniqueName := item.imageInfo.UniqueName
+	result := pushResult{index: item.index, uniqueName: uniqueName}
+
+	if item.err != nil {
+		result.entry = JournalEntry{UniqueName: uniqueName, Status: JournalStatusFailed, Error: item.err.Error()}
+		result.status = JournalStatusFailed
+		result.message = fmt.Sprintf("Skipping image %s: %s", uniqueName, item.err.Error())
+		return result
+	}
+
+	//images that were donated before, but whose annotations failed, aren't donated again
+	imageId := ""
+	if p.options.Journal != nil {
+		if entry, ok := p.options.Journal.Get(uniqueName); ok && entry.Status == JournalStatusDonated && entry.ImageId != "" {
+			imageId = entry.ImageId
+		}
+	}
+
+	if imageId == "" {
+		var err error
+		imageId, err = p.imageMonkeyAPI.AddLabelMeDonationContext(ctx, item.img.ScaledImage, item.img.Url, p.label, p.options.AutoUnlock)
+		switch imagemonkey.ErrorKindOf(err) {
+		case imagemonkey.ErrorDuplicateImage:
+			result.entry = JournalEntry{UniqueName: uniqueName, Status: JournalStatusDuplicate, Error: err.Error()}
+			result.status = JournalStatusDuplicate
+			result.message = fmt.Sprintf("Skipping image %s: ImageMonkey already has it", uniqueName)
+			return result
+		case imagemonkey.ErrorAuthentication:
+			result.entry = JournalEntry{UniqueName: uniqueName, Status: JournalStatusFailed, Error: err.Error()}
+			p.fail(fmt.Errorf("aborting push: %w", err))
+			result.status = JournalStatusFailed
+			result.message = fmt.Sprintf("Couldn't donate image %s: %s", uniqueName, err.Error())
+			return result
+		}
+		if err != nil {
+			result.entry = JournalEntry{UniqueName: uniqueName, Status: JournalStatusFailed, Error: err.Error()}
+			result.status = JournalStatusFailed
+			result.message = fmt.Sprintf("Couldn't donate image %s: %s", uniqueName, err.Error())
+			return result
+		}
+		result.message = fmt.Sprintf("Added image: %s", uniqueName)
+	}
+
+	//without the id the annotations can't be added, and a donated entry without the id
+	//would be donated again by the next push. The image is recorded as failed, the next
+	//push then gets a duplicate for it.
+	if imageId == "" && p.options.Annotations {
+		err := errors.New("the server didn't return the id of the donated image")
+		result.entry = JournalEntry{UniqueName: uniqueName, Status: JournalStatusFailed, Error: err.Error()}
+		result.status = JournalStatusFailed
+		result.message = fmt.Sprintf("Couldn't add annotations to image %s: %s", uniqueName, err.Error())
+		return result
+	}
+
+	if p.options.Annotations {
+		err := addAnnotations(ctx, p.imageMonkeyAPI, imageId, p.label, item.annotation, item.img)
+		if err != nil {
+			result.entry = JournalEntry{UniqueName: uniqueName, Status: JournalStatusDonated, ImageId: imageId, Error: err.Error()}
+			if imagemonkey.ErrorKindOf(err) == imagemonkey.ErrorAuthentication {
+				p.fail(fmt.Errorf("aborting push: %w", err))
+			}
+			result.status = JournalStatusDonated
+			result.message = fmt.Sprintf("Couldn't add annotations to image %s: %s", uniqueName, err.Error())
+			return result
+		}
+	}
+
+	result.entry = JournalEntry{UniqueName: uniqueName, Status: JournalStatusDone, ImageId: imageId}
+	result.status = JournalStatusDone
+	if result.message == "" {
+		result.message = fmt.Sprintf("Added annotations to image: %s", uniqueName)
+	}
+	return result
+}
+
+//pushProgress prints the messages of the pushed images in the order of the images
+//(regardless of the order in which the workers finish them), together with a progress
+//line. The journal entries are recorded in the same order. On a terminal the progress
+//line is redrawn in place, otherwise it is printed every progressLogInterval.
+type pushProgress struct {
+	label string
+	total int
+	numDone int
+	numFailed int
+	numSkipped int
+	processed int
+	start time.Time
+	terminal bool
+	lastPrint time.Time
+	next int
+	buffered map[int]pushResult
+	//records the journal entry of a result (may be nil)
+	record func(entry JournalEntry)
+}
+
+const progressLogInterval = 10 * time.Second
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode() & os.ModeCharDevice != 0
+}
+
+func newPushProgress(label string, total int, numSkipped int) *pushProgress {
+	return &pushProgress{
+		label: label,
+		total: total,
+		numSkipped: numSkipped,
+		start: time.Now(),
+		terminal: isTerminal(os.Stdout),
+		lastPrint: time.Now(),
+		buffered: make(map[int]pushResult),
+	}
+}
+
+//report consumes the results until the channel is closed
+func (p *pushProgress) report(results <-chan pushResult) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				p.flush()
+				p.clearLine()
+				return
+			}
+			p.add(result)
+		case <-ticker.C:
+			p.draw()
+		}
+	}
+}
+
+func (p *pushProgress) add(result pushResult) {
+	switch result.status {
+	case JournalStatusDone:
+		p.numDone++
+	case JournalStatusDuplicate:
+		p.numSkipped++
+	default:
+		p.numFailed++
+	}
+	p.processed++
+
+	p.buffered[result.index] = result
+	for {
+		next, ok := p.buffered[p.next]
+		if !ok {
+			break
+		}
+		delete(p.buffered, p.next)
+		p.next++
+		p.emit(next)
+	}
+	p.draw()
+}
+
+//emit records the journal entry of the result and prints its message
+func (p *pushProgress) emit(result pushResult) {
+	if p.record != nil {
+		p.record(result.entry)
+	}
+	p.println(result.message)
+}
+
+//flush prints the messages that are still buffered because the images before them
+//weren't pushed (the push was stopped)
+func (p *pushProgress) flush() {
+	for len(p.buffered) > 0 {
+		if result, ok := p.buffered[p.next]; ok {
+			delete(p.buffered, p.next)
+			p.emit(result)
+		}
+		p.next++
+	}
+}
+
+func (p *pushProgress) line() string {
+	elapsed := time.Since(p.start)
+	s := fmt.Sprintf("%s: [%d/%d] done %d, failed %d, skipped %d", p.label, p.processed, p.total, p.numDone, p.numFailed, p.numSkipped)
+	if p.processed == 0 || elapsed <= 0 {
+		return s
+	}
+
+	rate := float64(p.processed) / elapsed.Seconds()
+	eta := time.Duration(float64(p.total - p.processed) / rate * float64(time.Second))
+	return s + fmt.Sprintf(", %.2f images/s, ETA %s", rate, eta.Round(time.Second))
+}
+
+func (p *pushProgress) clearLine() {
+	if p.terminal {
+		fmt.Printf("\r\033[K")
+	}
+}
+
+func (p *pushProgress) println(message string) {
+	p.clearLine()
+	fmt.Println(message)
+}
+
+func (p *pushProgress) draw() {
+	if p.terminal {
+		fmt.Printf("\r%s\033[K", p.line())
+		return
+	}
+	if time.Since(p.lastPrint) >= progressLogInterval {
+		fmt.Println(p.line())
+		p.lastPrint = time.Now()
+	}
+}
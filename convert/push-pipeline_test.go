@@ -0,0 +1,279 @@
+package convert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/imagemonkey"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+)
+
+//fakeImageMonkey is an ImageMonkey API that accepts every donation and annotation.
+//The donate handler returns the uuid returned by uuid (no uuid if it returns "").
+type fakeImageMonkey struct {
+	server *httptest.Server
+	uuid func(r *http.Request) string
+
+	mutex sync.Mutex
+	donations int
+	annotated []string
+}
+
+func newFakeImageMonkey(t *testing.T, uuid func(r *http.Request) string) *fakeImageMonkey {
+	f := &fakeImageMonkey{uuid: uuid}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/internal/labelme/donate", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		f.donations++
+		f.mutex.Unlock()
+		if id := f.uuid(r); id != "" {
+			json.NewEncoder(w).Encode(map[string]string{"uuid": id})
+		}
+	})
+	mux.HandleFunc("/v1/annotate/", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		f.annotated = append(f.annotated, strings.TrimPrefix(r.URL.Path, "/v1/annotate/"))
+		f.mutex.Unlock()
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeImageMonkey) client() *imagemonkey.Client {
+	return imagemonkey.NewClient(f.server.URL, "client-id", "client-secret")
+}
+
+func (f *fakeImageMonkey) counts() (int, []string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.donations, append([]string(nil), f.annotated...)
+}
+
+//newDecodedImage returns a decoded image with a single car
+func newDecodedImage(index int, uniqueName string) decodedImage {
+	car := labelme.Object{Name: "car", Polygon: labelme.Polygon{Points: []labelme.Point{{X: 0, Y: 0}, {X: 4, Y: 0}, {X: 4, Y: 4}}}}
+	return decodedImage{
+		index: index,
+		imageInfo: labelme.ImageInfo{UniqueName: uniqueName},
+		img: labelme.Image{ScaledImage: image.NewRGBA(image.Rect(0, 0, 8, 8)), ScaleFactor: 1},
+		annotation: labelme.Annotation{Objects: []labelme.Object{car}},
+	}
+}
+
+func openTestJournal(t *testing.T, path string) *PushJournal {
+	journal, err := OpenPushJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { journal.Close() })
+	return journal
+}
+
+func TestPushPipelineUploadWithoutImageId(t *testing.T) {
+	api := newFakeImageMonkey(t, func(r *http.Request) string { return "" })
+	path := filepath.Join(t.TempDir(), "car.jsonl")
+	journal := openTestJournal(t, path)
+
+	pipeline := &pushPipeline{imageMonkeyAPI: api.client(), label: "car", options: PushOptions{Annotations: true, Journal: journal}}
+	result := pipeline.upload(context.Background(), newDecodedImage(0, "folder_image.jpg"))
+	pipeline.record(result.entry)
+	if result.status != JournalStatusFailed {
+		t.Errorf("got status %s, want %s", result.status, JournalStatusFailed)
+	}
+
+	entry, ok := journal.Get("folder_image.jpg")
+	if !ok || entry.Status != JournalStatusFailed || !strings.Contains(entry.Error, "didn't return the id") {
+		t.Errorf("unexpected journal entry %+v", entry)
+	}
+	donations, annotated := api.counts()
+	if donations != 1 || len(annotated) != 0 {
+		t.Errorf("got %d donations and annotations %v, want one donation and no annotations", donations, annotated)
+	}
+
+	//without annotations the id isn't needed
+	pipeline.options.Annotations = false
+	result = pipeline.upload(context.Background(), newDecodedImage(0, "folder_other.jpg"))
+	if result.status != JournalStatusDone {
+		t.Errorf("got status %s without annotations, want %s", result.status, JournalStatusDone)
+	}
+}
+
+//fakeSource has images named 000.jpg, 001.jpg, ... with a single car each. The
+//earlier images take longer to load, so that the decode workers finish out of order.
+type fakeSource struct {
+	mutex sync.Mutex
+	loaded int
+}
+
+func fakeImageIndex(uniqueName string) int {
+	var index int
+	fmt.Sscanf(uniqueName, "%d.jpg", &index)
+	return index
+}
+
+func fakeImageInfos(n int) []labelme.ImageInfo {
+	var imageInfos []labelme.ImageInfo
+	for i := 0; i < n; i++ {
+		imageInfos = append(imageInfos, labelme.ImageInfo{UniqueName: fmt.Sprintf("%03d.jpg", i)})
+	}
+	return imageInfos
+}
+
+func (p *fakeSource) Name() string { return "fake" }
+func (p *fakeSource) LoadContext(ctx context.Context) error { return nil }
+func (p *fakeSource) GetLabelMapper() *labelme.LabelMapper { return labelme.DefaultLabelMapper() }
+func (p *fakeSource) Labels(ctx context.Context, filter *labelme.ObjectFilter) (map[string]int32, error) { return nil, nil }
+func (p *fakeSource) GetImageInfos(label string) ([]labelme.ImageInfo, error) { return nil, nil }
+func (p *fakeSource) FindImageInfos(filter *labelme.ObjectFilter) []labelme.ImageInfo { return nil }
+func (p *fakeSource) GetCacheDirectory() string { return "" }
+
+func (p *fakeSource) DownloadImagesContext(ctx context.Context, imageInfos []labelme.ImageInfo, label string) error {
+	return nil
+}
+
+func (p *fakeSource) GetImageContext(ctx context.Context, label string, imageInfo labelme.ImageInfo, scaled bool) (labelme.Image, error) {
+	p.mutex.Lock()
+	p.loaded++
+	p.mutex.Unlock()
+
+	select {
+	case <-time.After(time.Duration(3 - fakeImageIndex(imageInfo.UniqueName) % 4) * time.Millisecond):
+	case <-ctx.Done():
+		return labelme.Image{}, ctx.Err()
+	}
+	return newDecodedImage(0, imageInfo.UniqueName).img, nil
+}
+
+func (p *fakeSource) GetAnnotationContext(ctx context.Context, imageInfo labelme.ImageInfo, filter *labelme.ObjectFilter) (labelme.Annotation, error) {
+	return newDecodedImage(0, imageInfo.UniqueName).annotation, nil
+}
+
+func (p *fakeSource) numLoaded() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.loaded
+}
+
+//readJournalNames returns the names of the journal entries in the order they were written
+func readJournalNames(t *testing.T, path string) []string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var entry JournalEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid journal line %q: %s", line, err.Error())
+		}
+		names = append(names, entry.UniqueName)
+	}
+	return names
+}
+
+func TestPushPipelineOrder(t *testing.T) {
+	//the uploads of the earlier images take longer as well
+	api := newFakeImageMonkey(t, func(r *http.Request) string {
+		sourceUrl := r.FormValue("image_source_url")
+		time.Sleep(time.Duration(3 - fakeImageIndex(sourceUrl) % 4) * time.Millisecond)
+		return "id-" + sourceUrl
+	})
+	path := filepath.Join(t.TempDir(), "car.jsonl")
+	journal := openTestJournal(t, path)
+
+	imageInfos := fakeImageInfos(20)
+	pipeline := &pushPipeline{
+		src: &fakeSource{},
+		imageMonkeyAPI: api.client(),
+		label: "car",
+		options: PushOptions{Annotations: true, Journal: journal, DecodeWorkers: 4, UploadWorkers: 4},
+	}
+	progress := newPushProgress("car", len(imageInfos), 0)
+	err := pipeline.run(context.Background(), imageInfos, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for _, imageInfo := range imageInfos {
+		want = append(want, imageInfo.UniqueName)
+	}
+	if names := readJournalNames(t, path); !reflect.DeepEqual(names, want) {
+		t.Errorf("got journal entries %v, want %v", names, want)
+	}
+	if progress.next != len(imageInfos) || progress.numDone != len(imageInfos) {
+		t.Errorf("progress printed %d messages and counted %d done images, want %d", progress.next, progress.numDone, len(imageInfos))
+	}
+}
+
+func TestPushPipelineCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mutex sync.Mutex
+	donations := 0
+	api := newFakeImageMonkey(t, func(r *http.Request) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		donations++
+		if donations == 5 {
+			cancel()
+		}
+		return "id-" + r.FormValue("image_source_url")
+	})
+	path := filepath.Join(t.TempDir(), "car.jsonl")
+	journal := openTestJournal(t, path)
+	src := &fakeSource{}
+	baseline := runtime.NumGoroutine()
+
+	imageInfos := fakeImageInfos(200)
+	pipeline := &pushPipeline{
+		src: src,
+		imageMonkeyAPI: api.client(),
+		label: "car",
+		options: PushOptions{Annotations: true, Journal: journal, DecodeWorkers: 4, UploadWorkers: 4},
+	}
+	done := make(chan error)
+	go func() {
+		done <- pipeline.run(ctx, imageInfos, newPushProgress("car", len(imageInfos), 0))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the pipeline didn't stop after the context was cancelled")
+	}
+
+	numDonations, _ := api.counts()
+	if numDonations >= 20 || src.numLoaded() >= 40 {
+		t.Errorf("got %d donations and %d loaded images after cancelling, want both stages to stop", numDonations, src.numLoaded())
+	}
+	//the uploads in flight are finished and recorded
+	if names := readJournalNames(t, path); len(names) != numDonations {
+		t.Errorf("got %d journal entries, want one per donation (%d)", len(names), numDonations)
+	}
+
+	http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+	api.server.CloseClientConnections()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > baseline {
+		t.Errorf("%d goroutines are still running after the pipeline stopped, want at most %d", n, baseline)
+	}
+}
@@ -0,0 +1,181 @@
+//Package convert converts LabelMe annotations into ImageMonkey annotations and pushes
+//the images of a source dataset to ImageMonkey.
+package convert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/imagemonkey"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/source"
+)
+
+//validateAnnotation checks the annotation against the image before it gets donated
+func validateAnnotation(annotation labelme.Annotation, filter *labelme.ObjectFilter, img labelme.Image) error {
+	err := annotation.ValidateImageSize(img.OriginalWidth, img.OriginalHeight)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range annotation.Objects {
+		if !filter.Match(object) {
+			continue
+		}
+
+		err = annotation.ValidateObject(object)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//PushOptions controls how the images are donated
+type PushOptions struct {
+	AutoUnlock bool
+	//add the polygons of the objects to the donated images
+	Annotations bool
+	//records the pushed images; images that were pushed completely are skipped (may be nil)
+	Journal *PushJournal
+	//don't donate anything, write a report of what would be donated to ReportDirectory
+	DryRun bool
+	ReportDirectory string
+	//name of the environment (for the report)
+	Environment string
+	//require one of the confirmations printed by a dry run of the same images
+	RequireConfirmation bool
+	Confirmations []string
+	//number of workers that load and scale the images, and that upload them
+	DecodeWorkers int
+	UploadWorkers int
+}
+
+//pendingImages returns the images that still have to be pushed, without the images
+//that are excluded by an exception and those that were already pushed completely
+func pendingImages(src source.Source, imageInfos []labelme.ImageInfo, journal *PushJournal) ([]labelme.ImageInfo, int, int) {
+	var pending []labelme.ImageInfo
+	numExcluded, numSkipped := 0, 0
+	for _, elem := range imageInfos {
+		if excluder, ok := src.(source.ImageExcluder); ok {
+			if exception, ok := excluder.GetImageException(elem); ok {
+				fmt.Printf("Skipping image %s: excluded by %s\n", elem.UniqueName, exception)
+				numExcluded++
+				continue
+			}
+		}
+		if journal != nil {
+			if entry, ok := journal.Get(elem.UniqueName); ok && (entry.Status == JournalStatusDone || entry.Status == JournalStatusDuplicate) {
+				numSkipped++
+				continue
+			}
+		}
+		pending = append(pending, elem)
+	}
+	if numSkipped > 0 {
+		fmt.Printf("Skipping %d images that were already pushed\n", numSkipped)
+	}
+	return pending, numExcluded, numSkipped
+}
+
+//ReadAnnotationContext returns the objects of the image that match the filter. The
+//masks of the source are resolved if resolveMasks is set or if the filter compares
+//the area or the points, as the mask objects don't have polygons before. In the
+//latter case the masks are resolved first and the objects are filtered afterwards.
+func ReadAnnotationContext(ctx context.Context, src source.Source, imageInfo labelme.ImageInfo, filter *labelme.ObjectFilter, resolveMasks bool) (labelme.Annotation, error) {
+	resolver, hasMasks := src.(source.MaskResolver)
+	if !hasMasks || !filter.UsesGeometry() {
+		annotation, err := src.GetAnnotationContext(ctx, imageInfo, filter)
+		if err != nil {
+			return annotation, fmt.Errorf("couldn't parse annotation: %s", err.Error())
+		}
+		if hasMasks && resolveMasks {
+			err = resolver.ResolveMasksContext(ctx, &annotation)
+			if err != nil {
+				return annotation, fmt.Errorf("couldn't resolve masks: %s", err.Error())
+			}
+		}
+		return annotation, nil
+	}
+
+	annotation, err := src.GetAnnotationContext(ctx, imageInfo, nil)
+	if err != nil {
+		return annotation, fmt.Errorf("couldn't parse annotation: %s", err.Error())
+	}
+	err = resolver.ResolveMasksContext(ctx, &annotation)
+	if err != nil {
+		return annotation, fmt.Errorf("couldn't resolve masks: %s", err.Error())
+	}
+	annotation.FilterObjects(filter)
+	return annotation, nil
+}
+
+//prepareAnnotation reads the annotation of the image, resolves the masks (if the
+//annotations are pushed as well and the source has masks) and validates the annotation against the image
+func prepareAnnotation(ctx context.Context, src source.Source, imageInfo labelme.ImageInfo, img labelme.Image, filter *labelme.ObjectFilter, options PushOptions) (labelme.Annotation, error) {
+	annotation, err := ReadAnnotationContext(ctx, src, imageInfo, filter, options.Annotations)
+	if err != nil {
+		return annotation, err
+	}
+	//with area or points the images are selected before the masks are resolved
+	if len(annotation.Objects) == 0 {
+		return annotation, fmt.Errorf("no object matches %s", filter)
+	}
+	return annotation, validateAnnotation(annotation, filter, img)
+}
+
+func hasConfirmation(confirmations []string, confirmation string) bool {
+	for _, c := range confirmations {
+		if c == confirmation {
+			return true
+		}
+	}
+	return false
+}
+
+//Push donates the given images of the source with the given label. The filter selects the
+//objects of the annotations that are validated and uploaded as annotations. When the
+//context is cancelled, the uploads in flight are finished and the push stops.
+func Push(ctx context.Context, src source.Source, imageMonkeyAPI *imagemonkey.Client, label string, imageInfos []labelme.ImageInfo, filter *labelme.ObjectFilter, options PushOptions) error {
+	pending, numExcluded, numSkipped := pendingImages(src, imageInfos, options.Journal)
+
+	confirmation := pushConfirmation(imageMonkeyAPI.BaseUrl(), label, options.AutoUnlock, pending)
+	if options.DryRun {
+		return dryRunImages(ctx, src, imageMonkeyAPI, label, pending, filter, options, confirmation)
+	}
+	if options.RequireConfirmation && !hasConfirmation(options.Confirmations, confirmation) {
+		if len(options.Confirmations) == 0 {
+			return fmt.Errorf("the environment %s requires a confirmation: run push with -dry-run first, check the report and pass the printed -confirm value", options.Environment)
+		}
+		return errors.New("the confirmation doesn't match the images of " + label + " that would be pushed (did the dataset change?), run push with -dry-run again")
+	}
+
+	pipeline := &pushPipeline{
+		src: src,
+		imageMonkeyAPI: imageMonkeyAPI,
+		label: label,
+		filter: filter,
+		options: options,
+	}
+	progress := newPushProgress(label, len(pending), numSkipped)
+	err := pipeline.run(ctx, pending, progress)
+
+	fmt.Printf("%s: pushed %d, failed %d, skipped %d, excluded %d images\n", label, progress.numDone, progress.numFailed, progress.numSkipped, numExcluded)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("push of %s was interrupted, %d images weren't pushed (run push again to resume)", label, len(pending) - progress.processed)
+	}
+	return nil
+}
+
+//addAnnotations uploads the polygons of the annotation, scaled to the donated image
+func addAnnotations(ctx context.Context, imageMonkeyAPI *imagemonkey.Client, imageId string, label string, annotation labelme.Annotation, img labelme.Image) error {
+	imageMonkeyAnnotation := FromLabelMe(label, annotation, img.ScaleFactor)
+	if len(imageMonkeyAnnotation.Annotations) == 0 {
+		return nil
+	}
+	return imageMonkeyAPI.AddAnnotationsContext(ctx, imageId, imageMonkeyAnnotation)
+}
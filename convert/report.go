@@ -0,0 +1,194 @@
+package convert
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/imagemonkey"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/source"
+)
+
+//DryRunImage describes what would be donated for an image
+type DryRunImage struct {
+	UniqueName string `json:"uniquename"`
+	Folder string `json:"folder"`
+	Filename string `json:"filename"`
+	//the image would be skipped because of this error
+	Error string `json:"error,omitempty"`
+	OriginalWidth int32 `json:"original_width"`
+	OriginalHeight int32 `json:"original_height"`
+	ScaledWidth int32 `json:"scaled_width"`
+	ScaledHeight int32 `json:"scaled_height"`
+	ScaleFactor float32 `json:"scalefactor"`
+	Annotations []imagemonkey.PolygonAnnotation `json:"annotations,omitempty"`
+	PayloadSize int `json:"payload_size"`
+}
+
+//DryRunReport is the result of a dry run of the push command
+type DryRunReport struct {
+	Environment string `json:"environment"`
+	Api string `json:"api"`
+	Label string `json:"label"`
+	AutoUnlock bool `json:"auto_unlock"`
+	Annotations bool `json:"annotations"`
+	CreatedAt time.Time `json:"created_at"`
+	//has to be passed to push -confirm in environments that require a confirmation
+	Confirmation string `json:"confirmation"`
+	NumImages int `json:"num_images"`
+	NumSkipped int `json:"num_skipped"`
+	TotalPayloadSize int64 `json:"total_payload_size"`
+	Images []DryRunImage `json:"images"`
+}
+
+//pushConfirmation identifies a push: the api, the label and the images that would be pushed
+func pushConfirmation(api string, label string, autoUnlock bool, imageInfos []labelme.ImageInfo) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%t\n", api, label, autoUnlock)
+	for _, imageInfo := range imageInfos {
+		fmt.Fprintf(h, "%s\n", imageInfo.UniqueName)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1 << 20:
+		return fmt.Sprintf("%.1f MB", float64(size) / (1 << 20))
+	case size >= 1 << 10:
+		return fmt.Sprintf("%.1f KB", float64(size) / (1 << 10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+//dryRunImages runs the push pipeline without donating anything and writes the report
+func dryRunImages(ctx context.Context, src source.Source, imageMonkeyAPI *imagemonkey.Client, label string, imageInfos []labelme.ImageInfo,
+	filter *labelme.ObjectFilter, options PushOptions, confirmation string) error {
+	report := DryRunReport{
+		Environment: options.Environment,
+		Api: imageMonkeyAPI.BaseUrl(),
+		Label: label,
+		AutoUnlock: options.AutoUnlock,
+		Annotations: options.Annotations,
+		CreatedAt: time.Now(),
+		Confirmation: confirmation,
+	}
+
+	for _, elem := range imageInfos {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		entry := DryRunImage{UniqueName: elem.UniqueName, Folder: elem.Folder, Filename: elem.Filename}
+
+		img, err := src.GetImageContext(ctx, label, elem, true)
+		if err != nil {
+			entry.Error = err.Error()
+			report.Images = append(report.Images, entry)
+			report.NumSkipped++
+			continue
+		}
+		entry.OriginalWidth, entry.OriginalHeight = img.OriginalWidth, img.OriginalHeight
+		entry.ScaledWidth, entry.ScaledHeight = img.ScaledWidth, img.ScaledHeight
+		entry.ScaleFactor = img.ScaleFactor
+
+		annotation, err := prepareAnnotation(ctx, src, elem, img, filter, options)
+		if err != nil {
+			entry.Error = err.Error()
+			report.Images = append(report.Images, entry)
+			report.NumSkipped++
+			continue
+		}
+
+		if options.Annotations {
+			entry.Annotations = FromLabelMe(label, annotation, img.ScaleFactor).Annotations
+		}
+
+		entry.PayloadSize, err = imageMonkeyAPI.LabelMeDonationSize(img.ScaledImage, img.Url, label, options.AutoUnlock)
+		if err != nil {
+			entry.Error = err.Error()
+			report.Images = append(report.Images, entry)
+			report.NumSkipped++
+			continue
+		}
+
+		report.Images = append(report.Images, entry)
+		report.NumImages++
+		report.TotalPayloadSize += int64(entry.PayloadSize)
+	}
+
+	err := os.MkdirAll(options.ReportDirectory, 0755)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("push-%s-%s-%s", options.Environment, strings.Replace(label, "/", "_", -1), report.CreatedAt.Format("20060102-150405"))
+	jsonPath := filepath.Join(options.ReportDirectory, name + ".json")
+	textPath := filepath.Join(options.ReportDirectory, name + ".txt")
+
+	err = report.writeJSON(jsonPath)
+	if err != nil {
+		return err
+	}
+	err = report.writeText(textPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: %d images would be pushed (%s), %d would be skipped\n", label, report.NumImages, formatSize(report.TotalPayloadSize), report.NumSkipped)
+	fmt.Printf("report written to %s and %s\n", textPath, jsonPath)
+	fmt.Printf("to push exactly these images, run push with -confirm %s\n", confirmation)
+	return nil
+}
+
+func (r DryRunReport) writeJSON(path string) error {
+	bytes, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bytes, 0644)
+}
+
+func (r DryRunReport) writeText(path string) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "DRY RUN\n\n")
+	fmt.Fprintf(&b, "environment:  %s\n", r.Environment)
+	fmt.Fprintf(&b, "API:          %s\n", r.Api)
+	fmt.Fprintf(&b, "label:        %s\n", r.Label)
+	fmt.Fprintf(&b, "auto unlock:  %t\n", r.AutoUnlock)
+	fmt.Fprintf(&b, "annotations:  %t\n", r.Annotations)
+	fmt.Fprintf(&b, "created at:   %s\n", r.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "#images:      %d (%s)\n", r.NumImages, formatSize(r.TotalPayloadSize))
+	fmt.Fprintf(&b, "#skipped:     %d\n", r.NumSkipped)
+	fmt.Fprintf(&b, "confirmation: %s\n\n", r.Confirmation)
+
+	for _, image := range r.Images {
+		if image.Error != "" {
+			fmt.Fprintf(&b, "SKIP %s: %s\n", image.UniqueName, image.Error)
+			continue
+		}
+
+		numPoints := 0
+		for _, annotation := range image.Annotations {
+			numPoints += len(annotation.Points)
+		}
+		fmt.Fprintf(&b, "PUSH %s: %dx%d => %dx%d, %d polygons (%d points), %s\n", image.UniqueName,
+			image.OriginalWidth, image.OriginalHeight, image.ScaledWidth, image.ScaledHeight,
+			len(image.Annotations), numPoints, formatSize(int64(image.PayloadSize)))
+		for _, annotation := range image.Annotations {
+			points := make([]string, len(annotation.Points))
+			for i, point := range annotation.Points {
+				points[i] = fmt.Sprintf("(%d,%d)", point.X, point.Y)
+			}
+			fmt.Fprintf(&b, "     polygon %s\n", strings.Join(points, " "))
+		}
+	}
+
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
+}
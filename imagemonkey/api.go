@@ -0,0 +1,258 @@
+//Package imagemonkey is a client of the ImageMonkey API. It donates images, adds
+//annotations to them and fetches the label catalogue of the server.
+package imagemonkey
+
+import (
+    "context"
+    "mime/multipart"
+    "net/http"
+    "bytes"
+    "encoding/json"
+    "image"
+    "image/jpeg"
+    "io/ioutil"
+    "errors"
+    "time"
+)
+
+func bool2string(in bool) string {
+    if in {
+        return "true"
+    }
+    return "false"
+}
+
+type PolyPoint struct {
+    X int32 `json:"x"`
+    Y int32 `json:"y"`
+}
+
+type PolygonAnnotation struct {
+    Points []PolyPoint `json:"points"`
+    Angle int32 `json:"angle"`
+    Type string `json:"type"`
+}
+
+
+type Annotation struct {
+    Annotations []PolygonAnnotation `json:"annotations"`
+    Label string `json:"label"`
+}
+
+type Client struct {
+	baseUrl string
+	clientId string
+	clientSecret string
+	labels *LabelCatalogue
+	labelCachePath string
+	labelCacheTTL time.Duration
+	client *apiClient
+}
+
+func NewClient(baseUrl string, clientId string, clientSecret string) *Client {
+    return &Client {
+        baseUrl: baseUrl,
+        clientId: clientId,
+        clientSecret: clientSecret,
+        labelCacheTTL: DefaultLabelCacheTTL,
+        client: newAPIClient(DefaultClientOptions()),
+    } 
+}
+
+//BaseUrl returns the base url of the ImageMonkey API
+func (p *Client) BaseUrl() string {
+    return p.baseUrl
+}
+
+//SetClientOptions configures the timeouts, retries and rate limit of the requests
+func (p *Client) SetClientOptions(options ClientOptions) {
+    p.client = newAPIClient(options)
+}
+
+func (p *Client) AddAnnotations(imageId string, annotation Annotation) error {
+    return p.AddAnnotationsContext(context.Background(), imageId, annotation)
+}
+
+//AddAnnotationsContext is AddAnnotations with a context that cancels the request (and its retries)
+func (p *Client) AddAnnotationsContext(ctx context.Context, imageId string, annotation Annotation) error {
+    url := p.baseUrl + "/v1/annotate/" + imageId
+
+
+    jsonStr, err := json.Marshal(annotation)
+    if err != nil {
+        return err
+    }
+
+    //adding the annotations twice would duplicate them
+    resp, err := p.client.do(ctx, false, func(ctx context.Context) (*http.Request, error) {
+        req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonStr))
+        if err != nil {
+            return nil, err
+        }
+        req.Header.Set("Content-Type", "application/json")
+        return req, nil
+    })
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    return checkResponse(resp)
+}
+
+//donateResponse is the response of the donate endpoints
+type donateResponse struct {
+    Uuid string `json:"uuid"`
+}
+
+//donationPayload builds the multipart form of a donation. It returns the form
+//together with its content type (which contains the boundary).
+func donationPayload(img image.Image, sourceUrl string, provider string, label string, autoUnlock bool) (*bytes.Buffer, string, error) {
+    var b bytes.Buffer
+    w := multipart.NewWriter(&b)
+
+    fw, err := w.CreateFormFile("image", "test.jpeg")
+    if err != nil {
+        return nil, "", err
+    }
+
+
+    buf := new(bytes.Buffer)
+    err = jpeg.Encode(buf, img, nil)
+    if err != nil {
+        return nil, "", err
+    }
+    
+    _, err = fw.Write(buf.Bytes())
+    if err != nil {
+        return nil, "", err
+    }
+
+    fw, err = w.CreateFormField("label")
+    if err != nil {
+        return nil, "", err
+    }
+    _, err = fw.Write([]byte(label))
+    if err != nil {
+        return nil, "", err
+    }
+
+
+    autoUnlockStr := bool2string(autoUnlock)
+
+    fw, err = w.CreateFormField("auto_unlock")
+    if err != nil {
+        return nil, "", err
+    }
+    _, err = fw.Write([]byte(autoUnlockStr))
+    if err != nil {
+        return nil, "", err
+    }
+
+    if provider == "labelme" {
+        fw, err = w.CreateFormField("image_source_url")
+        if err != nil {
+            return nil, "", err
+        }
+        _, err = fw.Write([]byte(sourceUrl))
+        if err != nil {
+            return nil, "", err
+        }
+    }
+
+    // Don't forget to close the multipart writer.
+    // If you don't close it, your request will be missing the terminating boundary.
+    err = w.Close()
+    if err != nil {
+        return nil, "", err
+    }
+
+    return &b, w.FormDataContentType(), nil
+}
+
+//LabelMeDonationSize returns the size of the request body AddLabelMeDonation would send
+func (p *Client) LabelMeDonationSize(img image.Image, sourceUrl string, label string, autoUnlock bool) (int, error) {
+    b, _, err := donationPayload(img, sourceUrl, "labelme", label, autoUnlock)
+    if err != nil {
+        return 0, err
+    }
+    return b.Len(), nil
+}
+
+//_donate uploads the image and returns the id of the new image. The id is empty if
+//the server accepted the image without returning it.
+func (p *Client) _donate(ctx context.Context, img image.Image, sourceUrl string, provider string, label string, autoUnlock bool) (string, error) {
+    url := ""
+    if provider == "donation" {
+        url = p.baseUrl + "/v1/donate"
+    } else if provider == "labelme" {
+        url = p.baseUrl + "/v1/internal/labelme/donate"
+    } else {
+        err := errors.New(("Invalid provider: " + provider))
+        return "", err
+    }
+
+    b, contentType, err := donationPayload(img, sourceUrl, provider, label, autoUnlock)
+    if err != nil {
+        return "", err
+    }
+
+    // Now that you have a form, you can submit it to your handler.
+    payload := b.Bytes()
+    //a donation that is sent twice would create the image twice (or fail with a 409)
+    res, err := p.client.do(ctx, false, func(ctx context.Context) (*http.Request, error) {
+        req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+        if err != nil {
+            return nil, err
+        }
+
+        if provider == "labelme" {
+            req.Header.Set("X-Client-Secret", p.clientSecret)
+            req.Header.Set("X-Client-Id", p.clientId)
+        }
+
+        // Don't forget to set the content type, this will contain the boundary.
+        req.Header.Set("Content-Type", contentType)
+        return req, nil
+    })
+    if err != nil {
+        return "", err
+    }
+    defer res.Body.Close()
+
+    // Check the response
+    err = checkResponse(res)
+    if err != nil {
+        return "", err
+    }
+
+    //the image was donated, a response without the uuid (e.g. an empty body) isn't
+    //an error, the id is just unknown then
+    var response donateResponse
+    body, err := ioutil.ReadAll(res.Body)
+    if err == nil {
+        json.Unmarshal(body, &response)
+    }
+    return response.Uuid, nil
+}
+
+//Donate uploads the image and returns the id ImageMonkey assigned to it
+func (p *Client) Donate(img image.Image, label string) (string, error) {
+    return p.DonateContext(context.Background(), img, label)
+}
+
+//DonateContext is Donate with a context that cancels the upload (and its retries)
+func (p *Client) DonateContext(ctx context.Context, img image.Image, label string) (string, error) {
+    return p._donate(ctx, img, "", "donation", label, false)
+}
+
+//AddLabelMeDonation uploads a LabelMe image and returns the id ImageMonkey assigned to it.
+//sourceUrl is the url of the image on the LabelMe website.
+func (p *Client) AddLabelMeDonation (img image.Image, sourceUrl string, label string, autoUnlock bool) (string, error) {
+    return p.AddLabelMeDonationContext(context.Background(), img, sourceUrl, label, autoUnlock)
+}
+
+//AddLabelMeDonationContext is AddLabelMeDonation with a context that cancels the upload (and its retries)
+func (p *Client) AddLabelMeDonationContext(ctx context.Context, img image.Image, sourceUrl string, label string, autoUnlock bool) (string, error) {
+    return p._donate(ctx, img, sourceUrl, "labelme", label, autoUnlock)
+}
@@ -0,0 +1,155 @@
+package imagemonkey
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//APIErrorKind classifies the errors returned by the ImageMonkey API
+type APIErrorKind int
+
+const (
+	ErrorUnknown APIErrorKind = iota
+	//the image was already donated
+	ErrorDuplicateImage
+	//the client id/secret are missing or invalid
+	ErrorAuthentication
+	//too many requests, try again later
+	ErrorRateLimited
+	//the request was rejected, e.g. because of an unknown label
+	ErrorValidation
+	//the server failed to process the request
+	ErrorServer
+)
+
+func (k APIErrorKind) String() string {
+	switch k {
+	case ErrorDuplicateImage:
+		return "duplicate image"
+	case ErrorAuthentication:
+		return "authentication failed"
+	case ErrorRateLimited:
+		return "rate limited"
+	case ErrorValidation:
+		return "validation error"
+	case ErrorServer:
+		return "server error"
+	}
+	return "unknown error"
+}
+
+//APIError is returned for every response of the ImageMonkey API that wasn't successful
+type APIError struct {
+	Kind APIErrorKind
+	StatusCode int
+	//id of the request (X-Request-Id), helps finding the request in the server logs
+	RequestId string
+	Message string
+	//time the server asked us to wait before retrying (Retry-After)
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	s := fmt.Sprintf("%s (%d)", e.Kind, e.StatusCode)
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	if e.RequestId != "" {
+		s += " [request id " + e.RequestId + "]"
+	}
+	return s
+}
+
+//Temporary returns true if the request might succeed when it is retried later
+func (e *APIError) Temporary() bool {
+	return e.Kind == ErrorRateLimited || e.Kind == ErrorServer
+}
+
+//errorResponse is the json body of an error response. ImageMonkey uses "error",
+//other proxies in front of it "message".
+type errorResponse struct {
+	Error string `json:"error"`
+	Message string `json:"message"`
+	RequestId string `json:"request_id"`
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+//newAPIError decodes the error of an unsuccessful response
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestId: resp.Header.Get("X-Request-Id"),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	var data errorResponse
+	if err := json.Unmarshal(body, &data); err == nil {
+		e.Message = data.Error
+		if e.Message == "" {
+			e.Message = data.Message
+		}
+		if e.RequestId == "" {
+			e.RequestId = data.RequestId
+		}
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusConflict,
+		strings.Contains(strings.ToLower(e.Message), "already exists"):
+		e.Kind = ErrorDuplicateImage
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		e.Kind = ErrorAuthentication
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.Kind = ErrorRateLimited
+	case resp.StatusCode == http.StatusBadRequest, resp.StatusCode == http.StatusUnprocessableEntity,
+		resp.StatusCode == http.StatusNotFound:
+		e.Kind = ErrorValidation
+	case resp.StatusCode >= 500:
+		e.Kind = ErrorServer
+	}
+	return e
+}
+
+//checkResponse returns an *APIError if the response wasn't successful (2xx)
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return newAPIError(resp, body)
+}
+
+//ErrorKindOf returns the kind of the error, ErrorUnknown if it isn't an *APIError
+func ErrorKindOf(err error) APIErrorKind {
+	var apiError *APIError
+	if errors.As(err, &apiError) {
+		return apiError.Kind
+	}
+	return ErrorUnknown
+}
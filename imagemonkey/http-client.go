@@ -0,0 +1,199 @@
+package imagemonkey
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//ClientOptions controls the HTTP client that talks to the ImageMonkey API
+type ClientOptions struct {
+	//timeout of a single request (including reading the response)
+	Timeout time.Duration
+	//number of retries of requests that failed with a network error, 429 or 5xx.
+	//Requests that aren't idempotent (like the donations) are only retried on 429 and
+	//if they couldn't be sent at all.
+	Retries int
+	//delay before the first retry, doubled after every retry up to MaxBackoff
+	Backoff time.Duration
+	MaxBackoff time.Duration
+	//maximum number of requests per second, 0 means unlimited
+	RequestsPerSecond float64
+	//called before a failed request is retried (may be nil)
+	OnRetry func(err error, delay time.Duration)
+}
+
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		Timeout: 60 * time.Second,
+		Retries: 3,
+		Backoff: 1 * time.Second,
+		MaxBackoff: 30 * time.Second,
+		RequestsPerSecond: 0,
+	}
+}
+
+//rateLimiter spaces requests evenly, so that at most rps requests are sent per second
+type rateLimiter struct {
+	mutex sync.Mutex
+	interval time.Duration
+	next time.Time
+}
+
+func newRateLimiter(rps float64) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+//Wait blocks until the next request may be sent. A nil limiter doesn't limit.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	//reserve the next slot
+	l.mutex.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mutex.Unlock()
+
+	return sleepContext(ctx, slot.Sub(now))
+}
+
+//sleepContext sleeps for d or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//apiClient is the HTTP client shared by all requests of an Client
+type apiClient struct {
+	http *http.Client
+	options ClientOptions
+	limiter *rateLimiter
+}
+
+//newAPIClient creates the client. Zero durations are replaced by the defaults, so that
+//options that only set e.g. the retries don't retry without delay.
+func newAPIClient(options ClientOptions) *apiClient {
+	defaults := DefaultClientOptions()
+	if options.Timeout <= 0 {
+		options.Timeout = defaults.Timeout
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = defaults.Backoff
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = defaults.MaxBackoff
+	}
+
+	return &apiClient{
+		http: &http.Client{Timeout: options.Timeout},
+		options: options,
+		limiter: newRateLimiter(options.RequestsPerSecond),
+	}
+}
+
+//isRetryableStatus returns true if the request can be sent again after the response.
+//A 429 means the server didn't process the request, after a 5xx the server may have
+//processed it nevertheless.
+func isRetryableStatus(statusCode int, idempotent bool) bool {
+	if statusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return idempotent && statusCode >= 500
+}
+
+//isRetryableError returns true if the request can be sent again after the error.
+//Requests that aren't idempotent are only retried if the server can't have seen
+//them, i.e. if the connection couldn't be established.
+func isRetryableError(err error, idempotent bool) bool {
+	if idempotent {
+		return true
+	}
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) {
+		return true
+	}
+	var opError *net.OpError
+	return errors.As(err, &opError) && opError.Op == "dial"
+}
+
+//do sends the request and retries it on network errors, 429 and 5xx responses with
+//exponential backoff (or the delay given by Retry-After). Requests that aren't
+//idempotent are only retried if the server didn't process them, see isRetryableStatus
+//and isRetryableError. newRequest is called for every attempt, as the body of a
+//request can only be read once. Other responses are returned as they are, the
+//caller has to close the body.
+func (c *apiClient) do(ctx context.Context, idempotent bool, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	backoff := c.options.Backoff
+	for attempt := 0; ; attempt++ {
+		err := c.limiter.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := newRequest(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var delay time.Duration
+		resp, err := c.http.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if !isRetryableError(err, idempotent) {
+				return nil, err
+			}
+		} else if isRetryableStatus(resp.StatusCode, idempotent) {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			apiError := newAPIError(resp, body)
+			err = apiError
+			delay = apiError.RetryAfter
+		} else {
+			return resp, nil
+		}
+
+		if attempt >= c.options.Retries {
+			return nil, err
+		}
+
+		if delay <= 0 {
+			delay = backoff
+			backoff *= 2
+			if backoff > c.options.MaxBackoff {
+				backoff = c.options.MaxBackoff
+			}
+		}
+		if c.options.OnRetry != nil {
+			c.options.OnRetry(err, delay)
+		}
+		err = sleepContext(ctx, delay)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
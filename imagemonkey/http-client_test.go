@@ -0,0 +1,161 @@
+package imagemonkey
+
+import (
+	"context"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+//response is a response of the test server
+type response struct {
+	status int
+	retryAfter string
+}
+
+//newSequenceServer returns the responses in order (the last one for all further
+//requests) and counts the requests
+func newSequenceServer(t *testing.T, responses []response) (*httptest.Server, func() int) {
+	var mutex sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		i := requests
+		requests++
+		mutex.Unlock()
+
+		if i >= len(responses) {
+			i = len(responses) - 1
+		}
+		if responses[i].retryAfter != "" {
+			w.Header().Set("Retry-After", responses[i].retryAfter)
+		}
+		w.WriteHeader(responses[i].status)
+		if responses[i].status == http.StatusOK && r.URL.Path == "/v1/label" {
+			w.Write([]byte(`["car"]`))
+		} else if responses[i].status == http.StatusOK {
+			w.Write([]byte(`{"uuid": "image-id"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return requests
+	}
+}
+
+func TestAPIClientRetries(t *testing.T) {
+	tests := []struct {
+		name string
+		responses []response
+		//the idempotent requests fetch the labels, the others donate an image
+		idempotent bool
+		requests int
+		//delays passed to OnRetry
+		delays []time.Duration
+		//kind of the error, ErrorUnknown if the request has to succeed
+		kind APIErrorKind
+	}{
+		{
+			name: "success",
+			responses: []response{{status: 200}},
+			idempotent: true,
+			requests: 1,
+		},
+		{
+			name: "429 with backoff",
+			responses: []response{{status: 429}, {status: 429}, {status: 200}},
+			idempotent: true,
+			requests: 3,
+			delays: []time.Duration{time.Millisecond, 2 * time.Millisecond},
+		},
+		{
+			name: "backoff is capped",
+			responses: []response{{status: 503}},
+			idempotent: true,
+			requests: 4,
+			delays: []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond},
+			kind: ErrorServer,
+		},
+		{
+			name: "Retry-After",
+			responses: []response{{status: 503, retryAfter: "1"}, {status: 200}},
+			idempotent: true,
+			requests: 2,
+			delays: []time.Duration{time.Second},
+		},
+		{
+			name: "client errors aren't retried",
+			responses: []response{{status: 400}},
+			idempotent: true,
+			requests: 1,
+			kind: ErrorValidation,
+		},
+		{
+			name: "429 of a donation is retried",
+			responses: []response{{status: 429}, {status: 200}},
+			requests: 2,
+			delays: []time.Duration{time.Millisecond},
+		},
+		{
+			name: "5xx of a donation isn't retried",
+			responses: []response{{status: 502}, {status: 200}},
+			requests: 1,
+			kind: ErrorServer,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := newSequenceServer(t, test.responses)
+
+			var delays []time.Duration
+			client := NewClient(server.URL, "id", "secret")
+			client.SetClientOptions(ClientOptions{
+				Retries: 3,
+				Backoff: time.Millisecond,
+				MaxBackoff: 3 * time.Millisecond,
+				OnRetry: func(err error, delay time.Duration) { delays = append(delays, delay) },
+			})
+
+			var err error
+			if test.idempotent {
+				_, err = client.fetchLabels(context.Background())
+			} else {
+				_, err = client.AddLabelMeDonationContext(context.Background(), image.NewRGBA(image.Rect(0, 0, 4, 4)), "http://labelme.invalid/1.jpg", "car", false)
+			}
+
+			if test.kind == ErrorUnknown && err != nil {
+				t.Errorf("request failed: %s", err.Error())
+			} else if test.kind != ErrorUnknown && ErrorKindOf(err) != test.kind {
+				t.Errorf("got error %v, want %s", err, test.kind)
+			}
+			if got := requests(); got != test.requests {
+				t.Errorf("got %d requests, want %d", got, test.requests)
+			}
+			if !reflect.DeepEqual(delays, test.delays) {
+				t.Errorf("got delays %v, want %v", delays, test.delays)
+			}
+		})
+	}
+}
+
+func TestNewAPIClientDefaults(t *testing.T) {
+	defaults := DefaultClientOptions()
+	client := newAPIClient(ClientOptions{Retries: 5})
+	if client.options.Backoff != defaults.Backoff || client.options.MaxBackoff != defaults.MaxBackoff {
+		t.Errorf("got backoff %s up to %s, want %s up to %s", client.options.Backoff, client.options.MaxBackoff, defaults.Backoff, defaults.MaxBackoff)
+	}
+	if client.http.Timeout != defaults.Timeout {
+		t.Errorf("got timeout %s, want %s", client.http.Timeout, defaults.Timeout)
+	}
+	if client.options.Retries != 5 {
+		t.Errorf("got %d retries, want 5", client.options.Retries)
+	}
+}
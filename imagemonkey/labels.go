@@ -0,0 +1,171 @@
+package imagemonkey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+//DefaultLabelCacheTTL is the time the label catalogue of the server is cached on disk
+const DefaultLabelCacheTTL = 24 * time.Hour
+
+//labelEntry is a label of the catalogue together with its sublabels
+type labelEntry struct {
+	Has map[string]labelEntry `json:"has"`
+}
+
+//LabelCatalogue contains the labels (and sublabels) the ImageMonkey server knows
+type LabelCatalogue struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Labels map[string][]string `json:"labels"`
+}
+
+//Contains returns true if the server knows the label
+func (c *LabelCatalogue) Contains(label string) bool {
+	_, ok := c.Labels[label]
+	return ok
+}
+
+//ContainsSublabel returns true if the server knows the label as sublabel of parent
+func (c *LabelCatalogue) ContainsSublabel(parent string, label string) bool {
+	for _, sublabel := range c.Labels[parent] {
+		if sublabel == label {
+			return true
+		}
+	}
+	return false
+}
+
+//Names returns the labels of the catalogue in alphabetical order
+func (c *LabelCatalogue) Names() []string {
+	names := make([]string, 0, len(c.Labels))
+	for name := range c.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//parseLabelCatalogue accepts a plain list of labels as well as a map of labels
+//to their sublabels ({"car": {"has": {"wheel": {}}}})
+func parseLabelCatalogue(body []byte) (*LabelCatalogue, error) {
+	catalogue := &LabelCatalogue{FetchedAt: time.Now(), Labels: make(map[string][]string)}
+
+	var names []string
+	if err := json.Unmarshal(body, &names); err == nil {
+		for _, name := range names {
+			catalogue.Labels[name] = nil
+		}
+		return catalogue, nil
+	}
+
+	var entries map[string]labelEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("couldn't parse label catalogue: %s", err.Error())
+	}
+	for name, entry := range entries {
+		var sublabels []string
+		for sublabel := range entry.Has {
+			sublabels = append(sublabels, sublabel)
+		}
+		sort.Strings(sublabels)
+		catalogue.Labels[name] = sublabels
+	}
+	return catalogue, nil
+}
+
+func readLabelCatalogue(path string) (*LabelCatalogue, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var catalogue LabelCatalogue
+	err = json.Unmarshal(bytes, &catalogue)
+	if err != nil {
+		return nil, err
+	}
+	return &catalogue, nil
+}
+
+func persistLabelCatalogue(path string, catalogue *LabelCatalogue) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(catalogue)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bytes, 0644)
+}
+
+//SetLabelCache enables the on-disk cache of the label catalogue
+func (p *Client) SetLabelCache(path string, ttl time.Duration) {
+	p.labelCachePath = path
+	p.labelCacheTTL = ttl
+}
+
+//GetLabels returns the label catalogue of the server. The catalogue is fetched once
+//and kept in memory; with SetLabelCache it is cached on disk as well.
+func (p *Client) GetLabels() (*LabelCatalogue, error) {
+	return p.GetLabelsContext(context.Background())
+}
+
+//GetLabelsContext is GetLabels with a context that cancels the request
+func (p *Client) GetLabelsContext(ctx context.Context) (*LabelCatalogue, error) {
+	if p.labels != nil {
+		return p.labels, nil
+	}
+
+	if p.labelCachePath != "" {
+		catalogue, err := readLabelCatalogue(p.labelCachePath)
+		if err == nil && time.Since(catalogue.FetchedAt) < p.labelCacheTTL {
+			p.labels = catalogue
+			return catalogue, nil
+		}
+	}
+
+	catalogue, err := p.fetchLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.labels = catalogue
+
+	if p.labelCachePath != "" {
+		err = persistLabelCatalogue(p.labelCachePath, catalogue)
+		if err != nil {
+			fmt.Printf("Couldn't cache label catalogue: %s\n", err.Error())
+		}
+	}
+	return catalogue, nil
+}
+
+func (p *Client) fetchLabels(ctx context.Context) (*LabelCatalogue, error) {
+	resp, err := p.client.do(ctx, true, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", p.baseUrl + "/v1/label", nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = checkResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch labels: %w", err)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLabelCatalogue(body)
+}
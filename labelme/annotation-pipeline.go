@@ -0,0 +1,131 @@
+package labelme
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var errPipelineStopped = errors.New("pipeline stopped")
+
+//ParsedAnnotation is an annotation together with the xml file it was parsed from
+type ParsedAnnotation struct {
+	Path string
+	Annotation Annotation
+}
+
+type ParseError struct {
+	Path string
+	Err error
+}
+
+func (e ParseError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+//AnnotationPipeline walks a directory and parses all xml files in it with a bounded
+//number of workers. The parsed annotations are streamed over Results() (in no
+//particular order), errors are collected and available via Errors() once Results()
+//is closed.
+type AnnotationPipeline struct {
+	results chan ParsedAnnotation
+	done chan struct{}
+	stopOnce sync.Once
+	mutex sync.Mutex
+	errors []ParseError
+}
+
+func DefaultParseWorkers() int {
+	return runtime.NumCPU()
+}
+
+func NewAnnotationPipeline(dir string, workers int, parse func(path string) (Annotation, error)) *AnnotationPipeline {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &AnnotationPipeline{
+		results: make(chan ParsedAnnotation, workers),
+		done: make(chan struct{}),
+	}
+
+	paths := make(chan string, workers)
+	go func() {
+		defer close(paths)
+		err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				p.addError(path, err)
+				return nil
+			}
+			if f.IsDir() || !strings.HasSuffix(path, ".xml") {
+				return nil
+			}
+
+			select {
+			case paths <- path:
+				return nil
+			case <-p.done:
+				return errPipelineStopped
+			}
+		})
+		if err != nil && err != errPipelineStopped {
+			p.addError(dir, err)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				annotation, err := parse(path)
+				if err != nil {
+					p.addError(path, err)
+					continue
+				}
+
+				select {
+				case p.results <- ParsedAnnotation{Path: path, Annotation: annotation}:
+				case <-p.done:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(p.results)
+	}()
+
+	return p
+}
+
+func (p *AnnotationPipeline) addError(path string, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.errors = append(p.errors, ParseError{Path: path, Err: err})
+}
+
+func (p *AnnotationPipeline) Results() <-chan ParsedAnnotation {
+	return p.results
+}
+
+//Errors returns the errors collected so far. The list is complete once Results() is closed.
+func (p *AnnotationPipeline) Errors() []ParseError {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]ParseError(nil), p.errors...)
+}
+
+//Stop aborts the pipeline, e.g. when the consumer fails. Results() is closed afterwards.
+func (p *AnnotationPipeline) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.done)
+	})
+	for range p.results {
+	}
+}
@@ -0,0 +1,169 @@
+package labelme
+
+import (
+	"fmt"
+	"strings"
+)
+
+//ObjectOptions controls which objects ParseAnnotationFromXml keeps
+type ObjectOptions struct {
+	//keep objects that were deleted in the LabelMe tool
+	IncludeDeleted bool
+	//only keep objects that were verified
+	OnlyVerified bool
+}
+
+func DefaultObjectOptions() ObjectOptions {
+	return ObjectOptions{
+		IncludeDeleted: false,
+		OnlyVerified: false,
+	}
+}
+
+func (o ObjectOptions) Keep(object Object) bool {
+	if object.IsDeleted() && !o.IncludeDeleted {
+		return false
+	}
+	if o.OnlyVerified && !object.IsVerified() {
+		return false
+	}
+	return true
+}
+
+//cacheSuffix distinguishes the cached label maps and image infos of different options
+func (o ObjectOptions) cacheSuffix() string {
+	suffix := ""
+	if o.IncludeDeleted {
+		suffix += ".with-deleted"
+	}
+	if o.OnlyVerified {
+		suffix += ".verified"
+	}
+	return suffix
+}
+
+func (o Object) IsDeleted() bool {
+	return o.Deleted == 1
+}
+
+func (o Object) IsVerified() bool {
+	return o.Verified == 1
+}
+
+func (o Object) IsOccluded() bool {
+	return strings.EqualFold(strings.TrimSpace(o.Occluded), "yes")
+}
+
+//Polygons returns the polygons of the object: either the polygon drawn in LabelMe
+//or, for objects annotated with the brush tool, the polygons traced from the mask.
+//Polygons with less than three points are omitted.
+func (o Object) Polygons() []Polygon {
+	if len(o.Polygon.Points) >= 3 {
+		return []Polygon{o.Polygon}
+	}
+
+	var polygons []Polygon
+	for _, polygon := range o.MaskPolygons {
+		if len(polygon.Points) >= 3 {
+			polygons = append(polygons, polygon)
+		}
+	}
+	return polygons
+}
+
+//GetId returns the id of the object within the annotation
+func (o Object) GetId() string {
+	return strings.TrimSpace(o.Id)
+}
+
+//GetUsername returns the user who annotated the object. Objects annotated with the
+//brush tool only have a segmentation, the user is recorded there.
+func (o Object) GetUsername() string {
+	if username := strings.TrimSpace(o.Polygon.Username); username != "" {
+		return username
+	}
+	return strings.TrimSpace(o.Segment.Username)
+}
+
+//PartIds returns the ids of the objects that are parts of this object
+func (o Object) PartIds() []string {
+	var ids []string
+	for _, id := range strings.Split(o.Parts.HasParts, ",") {
+		id = strings.TrimSpace(id)
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+//ParentId returns the id of the object this object is part of, or an empty string
+func (o Object) ParentId() string {
+	return strings.TrimSpace(o.Parts.IsPartOf)
+}
+
+//GetObjectById returns the object with the given id
+func (a Annotation) GetObjectById(id string) (Object, bool) {
+	for _, object := range a.Objects {
+		if object.GetId() == id {
+			return object, true
+		}
+	}
+	return Object{}, false
+}
+
+//GetParts returns the objects that are parts of the given object
+func (a Annotation) GetParts(object Object) []Object {
+	var parts []Object
+	for _, id := range object.PartIds() {
+		if part, ok := a.GetObjectById(id); ok {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+//GetParent returns the object the given object is part of
+func (a Annotation) GetParent(object Object) (Object, bool) {
+	id := object.ParentId()
+	if id == "" {
+		return Object{}, false
+	}
+	return a.GetObjectById(id)
+}
+
+//HasImageSize returns true if the annotation declares the size of the image
+func (a Annotation) HasImageSize() bool {
+	return a.ImageSize.NCols > 0 && a.ImageSize.NRows > 0
+}
+
+//ValidateObject checks that all points of the object are within the declared
+//image size. Annotations without an image size can't be validated and pass.
+func (a Annotation) ValidateObject(object Object) error {
+	if !a.HasImageSize() {
+		return nil
+	}
+
+	for _, polygon := range object.Polygons() {
+		for _, point := range polygon.Points {
+			if point.X < 0 || point.Y < 0 || point.X >= a.ImageSize.NCols || point.Y >= a.ImageSize.NRows {
+				return fmt.Errorf("point (%d, %d) of object %s is outside of the image (%dx%d)",
+					point.X, point.Y, object.Name, a.ImageSize.NCols, a.ImageSize.NRows)
+			}
+		}
+	}
+	return nil
+}
+
+//ValidateImageSize checks that the declared image size matches the actual size of the image
+func (a Annotation) ValidateImageSize(width int32, height int32) error {
+	if !a.HasImageSize() {
+		return nil
+	}
+
+	if a.ImageSize.NCols != width || a.ImageSize.NRows != height {
+		return fmt.Errorf("declared image size %dx%d doesn't match the actual size %dx%d",
+			a.ImageSize.NCols, a.ImageSize.NRows, width, height)
+	}
+	return nil
+}
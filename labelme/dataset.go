@@ -0,0 +1,969 @@
+//Package labelme reads the LabelMe dataset: it mirrors the annotations from the LabelMe
+//website, parses and indexes them, downloads the images and maps the LabelMe names to
+//ImageMonkey labels.
+package labelme
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"encoding/xml"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+	_"image/jpeg"
+	_"image/png"
+	"image"
+	"github.com/nfnt/resize"
+)
+
+type Box struct {
+	XMLName xml.Name `xml:"box"`
+	Xmin float32 `xml:"xmin"`
+	Ymin float32 `xml:"ymin"`
+	Xmax float32 `xml:"xmax"`
+	Ymax float32 `xml:"ymax"`
+}
+
+type Segment struct {
+	XMLName xml.Name `xml:"segm"`
+	Username string `xml:"username"`
+	Box Box `xml:"box,omitempty"`
+	Mask string `xml:"mask"`
+}
+
+type Point struct {
+	XMLName xml.Name `xml:"pt"`
+	X int32 `xml:"x"`
+	Y int32 `xml:"y"`
+}
+
+type Polygon struct {
+	XMLName xml.Name `xml:"polygon"`
+	Username string `xml:"username"`
+	Points []Point `xml:"pt"`
+}
+
+type Parts struct {
+	XMLName xml.Name `xml:"parts"`
+	HasParts string `xml:"hasparts"`
+	IsPartOf string `xml:"ispartof"`
+}
+
+type Object struct {
+	XMLName xml.Name `xml:"object"`
+	Id string `xml:"id"`
+	Name string `xml:"name"`
+	Deleted int `xml:"deleted"`
+	Verified int `xml:"verified"`
+	Occluded string `xml:"occluded"`
+	Attributes string `xml:"attributes"`
+	Parts Parts `xml:"parts"`
+	Date string `xml:"date"`
+	Polygon Polygon `xml:"polygon,omitempty"`
+	Segment Segment `xml:"segm,omitempty"`
+	//polygons traced from the mask of the segmentation, see ResolveMasks
+	MaskPolygons []Polygon `xml:"-"`
+}
+
+type ImageSize struct {
+	XMLName xml.Name `xml:"imagesize"`
+	NRows int32 `xml:"nrows"`
+	NCols int32 `xml:"ncols"`
+}
+
+type Source struct {
+	XMLName xml.Name `xml:"source"`
+	SourceImage string `xml:"sourceImage"`
+	SourceAnnotation string `xml:"sourceAnnotation"`
+}
+
+type Annotation struct {
+	XMLName xml.Name `xml:"annotation"`
+	Objects []Object `xml:"object"`
+	Filename string `xml:"filename"`
+	Folder string `xml:"folder"`
+	Source Source `xml:"source"`
+	ImageSize ImageSize `xml:"imagesize"`
+}
+
+type Label struct {
+	Name string `json:"name"`
+	Num int32 `json:"num"`
+}
+
+type ImageInfo struct {
+	Folder string `json:"folder"`
+	Filename string `json:"filename"`
+	UniqueName string `json:"uniquename"`
+}
+
+type Image struct {
+	OriginalImage image.Image `json:"original_image"`
+	ScaledImage image.Image `json:"scaled_image"`
+	OriginalWidth int32 `json:"original_width"`
+	OriginalHeight int32 `json:"original_height"`
+	ScaledWidth int32 `json:"scaled_width"`
+	ScaledHeight int32 `json:"scaled_height"`
+	ScaleFactor float32 `json:"scalefactor"`
+	Url string `json:"url"`
+}
+
+func calcScaleFactor(img Image) float32 {
+	var maxSize int32
+	var scaleFactor float32
+
+	maxSize = 1000
+	scaleFactor = 1.0
+
+	if img.OriginalWidth > img.OriginalHeight {
+		if img.OriginalWidth > maxSize {
+			scaleFactor = float32(maxSize)/float32(img.OriginalWidth)
+		} else {
+			scaleFactor = 1.0
+		}
+	} else {
+		if img.OriginalHeight > maxSize {
+			scaleFactor = float32(maxSize)/float32(img.OriginalHeight)
+		} else {
+			scaleFactor = 1.0
+		}
+	}
+
+	return scaleFactor
+}
+
+func readCachedLabelMap(path string) (map[string]int32, error) {
+	labelMap := make(map[string]int32)
+
+	bytes, err := ioutil.ReadFile(path)
+    if err != nil {
+        fmt.Println(err.Error())
+        return labelMap, err
+    }
+
+    var labels []Label
+    err = json.Unmarshal(bytes, &labels)
+    if err != nil {
+    	fmt.Println(err.Error())
+    	return labelMap, err
+    }
+
+    for _, label := range labels {
+    	labelMap[label.Name] = label.Num
+    }
+
+    return labelMap, nil
+}
+
+
+func readCachedImageInfos(path string) ([]ImageInfo, error) {
+	var imageInfos []ImageInfo
+
+	bytes, err := ioutil.ReadFile(path)
+    if err != nil {
+        fmt.Println(err.Error())
+        return imageInfos, err
+    }
+
+    
+    err = json.Unmarshal(bytes, &imageInfos)
+    if err != nil {
+    	fmt.Println(err.Error())
+    	return imageInfos, err
+    }
+
+    return imageInfos, nil
+}
+
+func persistLabelMap(path string, labelMap map[string]int32) error {
+	var labels []Label
+	for k, v := range labelMap {
+		var label Label
+		label.Name = k
+		label.Num = v
+		labels = append(labels, label)
+	}
+
+	bytes, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path, bytes, 0644)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func persistImageInfos(path string, imageInfos []ImageInfo) error {
+	bytes, err := json.Marshal(imageInfos)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path, bytes, 0644)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func convertToLocalFilename(folder string, filename string) string {
+	return folder + "_" + filename
+}
+
+func imageInfoFromAnnotation(annotation Annotation) ImageInfo {
+	var imageInfo ImageInfo
+	//trim any newline characters in the folder/file name (for some reason, there are some
+	//files in the labelme dataset that have newline chars?)
+	imageInfo.Filename = strings.Trim(annotation.Filename, "\r\n")
+	imageInfo.Folder = strings.Trim(annotation.Folder, "\r\n")
+	imageInfo.UniqueName = convertToLocalFilename(imageInfo.Folder, imageInfo.Filename)
+	return imageInfo
+}
+
+func readImageExceptions(path string) ([]ImageException, error) {
+	var exceptions []ImageException
+
+	bytes, err := ioutil.ReadFile(path)
+    if err != nil {
+        return exceptions, err
+    }
+
+    
+    err = json.Unmarshal(bytes, &exceptions)
+    if err != nil {
+    	return exceptions, err
+    }
+
+    return exceptions, nil
+} 
+
+type Dataset struct {
+	baseDirectory string
+	labels map[string]int32
+	baseUrl string
+	useCache bool
+	imageExceptions []ImageException
+	mirrorConcurrency int
+	downloadOptions DownloadOptions
+	httpClient *http.Client
+	parseWorkers int
+	objectOptions ObjectOptions
+	labelMapper *LabelMapper
+}
+
+//mirrorCompleteMarker is written to the base directory once the annotations are
+//completely mirrored. Without it, Load resumes the download.
+const mirrorCompleteMarker = ".mirror-complete"
+
+func NewDataset(baseDirectory string, useCache bool) *Dataset {
+    return &Dataset{
+    	labels: make(map[string]int32),
+    	baseUrl: "http://people.csail.mit.edu/brussell/research/LabelMe/",
+    	useCache: useCache,
+    	baseDirectory: baseDirectory,
+    	mirrorConcurrency: DefaultMirrorConcurrency,
+    	downloadOptions: DefaultDownloadOptions(),
+    	httpClient: &http.Client{Timeout: 60 * time.Second},
+    	parseWorkers: DefaultParseWorkers(),
+    	objectOptions: DefaultObjectOptions(),
+    	labelMapper: DefaultLabelMapper(),
+    } 
+}
+
+func (p *Dataset) SetMirrorConcurrency(concurrency int) {
+	p.mirrorConcurrency = concurrency
+}
+
+func (p *Dataset) SetDownloadOptions(options DownloadOptions) {
+	p.downloadOptions = options
+}
+
+func (p *Dataset) Load() error {
+	return p.LoadContext(context.Background())
+}
+
+//LoadContext is Load with a context. A cancelled download of the annotations is
+//resumed by the next call.
+func (p *Dataset) LoadContext(ctx context.Context) error {
+	completeMarkerPath := p.baseDirectory + "/" + mirrorCompleteMarker
+	if _, err := os.Stat(p.baseDirectory); os.IsNotExist(err) {
+		fmt.Printf("dataset doesn't exist...downloading\n")
+		err = os.MkdirAll(p.baseDirectory, 0755)
+		if err != nil {
+			fmt.Printf("Couldn't create folder: %s\n", p.baseDirectory)
+			return errors.New(("Couldn't create folder " + p.baseDirectory))
+		}
+	} else if _, err := os.Stat(completeMarkerPath); err == nil {
+		fmt.Println("dataset already exists...using this one")
+	} else {
+		fmt.Println("dataset is incomplete...resuming download")
+	}
+
+	if _, err := os.Stat(completeMarkerPath); os.IsNotExist(err) {
+		//download labelme dataset
+		manifest, err := readManifest(p.getManifestPath())
+		if err != nil {
+			return err
+		}
+		mirror := NewMirror(p.baseUrl, p.GetMirrorDirectory(), manifest, p.mirrorConcurrency)
+		result, err := mirror.MirrorContext(ctx, "Annotations/")
+		fmt.Printf("downloaded %d, skipped %d, failed %d files\n", len(result.Added), result.Skipped, len(result.Failed))
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(completeMarkerPath, []byte(time.Now().Format(time.RFC3339)), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.LoadImageExceptions()
+}
+
+//Sync fetches the annotations that were added or changed since the last sync and
+//removes the ones that no longer exist. If anything changed, the cached label map
+//and image infos are invalidated.
+func (p *Dataset) Sync() (MirrorResult, error) {
+	return p.SyncContext(context.Background())
+}
+
+//SyncContext is Sync with a context
+func (p *Dataset) SyncContext(ctx context.Context) (MirrorResult, error) {
+	var result MirrorResult
+
+	err := os.MkdirAll(p.baseDirectory, 0755)
+	if err != nil {
+		return result, err
+	}
+
+	manifest, err := readManifest(p.getManifestPath())
+	if err != nil {
+		return result, err
+	}
+
+	mirror := NewMirror(p.baseUrl, p.GetMirrorDirectory(), manifest, p.mirrorConcurrency)
+	result, err = mirror.SyncContext(ctx, "Annotations/")
+	if len(result.Added) > 0 || len(result.Changed) > 0 || len(result.Removed) > 0 {
+		invalidateErr := p.invalidateCache()
+		if invalidateErr == nil && p.HasIndex() {
+			fmt.Println("annotations changed...rebuilding index")
+			invalidateErr = p.Index()
+		}
+		if invalidateErr != nil && err == nil {
+			err = invalidateErr
+		}
+	}
+	if err != nil {
+		return result, err
+	}
+
+	err = ioutil.WriteFile(p.baseDirectory + "/" + mirrorCompleteMarker, []byte(time.Now().Format(time.RFC3339)), 0644)
+	return result, err
+}
+
+//invalidateCache removes the cached label map and image infos, as they are
+//derived from the annotations
+func (p *Dataset) invalidateCache() error {
+	cacheDir := p.GetCacheDirectory()
+	files, err := filepath.Glob(cacheDir + "*.tmp")
+	if err != nil {
+		return err
+	}
+	labelMaps, err := filepath.Glob(cacheDir + "labels*.map")
+	if err != nil {
+		return err
+	}
+	files = append(files, labelMaps...)
+
+	for _, file := range files {
+		if filepath.Base(file) == "exceptions.tmp" {
+			continue
+		}
+
+		err = os.Remove(file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Dataset) getIndexPath() string {
+	return p.baseDirectory + "/index.db"
+}
+
+//HasIndex returns true if the index was built with Index()
+func (p *Dataset) HasIndex() bool {
+	_, err := os.Stat(p.getIndexPath())
+	return err == nil
+}
+
+//Index parses all annotations of the dataset and stores them in the index. Once the
+//index exists, BuildLabelMap and GetImageInfos are served from it.
+func (p *Dataset) Index() error {
+	index, err := OpenIndex(p.getIndexPath())
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+
+	//the index contains the deleted objects as well, they are filtered when querying
+	pipeline := p.parseAnnotations(ObjectOptions{IncludeDeleted: true})
+	err = index.Rebuild(pipeline.Results())
+	if err != nil {
+		pipeline.Stop()
+		return err
+	}
+	printParseErrors(pipeline.Errors())
+	return nil
+}
+
+func (p *Dataset) openIndex() (*Index, error) {
+	index, err := OpenIndex(p.getIndexPath())
+	if err != nil {
+		return nil, err
+	}
+
+	err = index.Verify()
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	return index, nil
+}
+
+//QueryImageInfos returns the images matching the query. This requires the index.
+//query.Label is an ImageMonkey label, it matches all LabelMe names mapped to it.
+func (p *Dataset) QueryImageInfos(query IndexQuery) ([]ImageInfo, error) {
+	if !p.HasIndex() {
+		return nil, errors.New("dataset isn't indexed yet, run the index command first")
+	}
+
+	index, err := p.openIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer index.Close()
+
+	query.ObjectOptions = p.objectOptions
+	if query.Label != "" {
+		labelMap, err := index.LabelMap(p.objectOptions)
+		if err != nil {
+			return nil, err
+		}
+		query.Names = p.labelMapper.Names(labelMap, query.Label)
+		query.Label = ""
+		if len(query.Names) == 0 {
+			return nil, nil
+		}
+	}
+	imageInfos, err := index.ImageInfos(query)
+	return p.filterImageExceptions(imageInfos), err
+}
+
+func (p *Dataset) SetParseWorkers(workers int) {
+	p.parseWorkers = workers
+}
+
+func (p *Dataset) SetObjectOptions(options ObjectOptions) {
+	p.objectOptions = options
+}
+
+//SetLabelMapper sets the mapping from LabelMe names to ImageMonkey labels that is
+//used by GetImageInfos and QueryImageInfos
+func (p *Dataset) SetLabelMapper(labelMapper *LabelMapper) {
+	p.labelMapper = labelMapper
+}
+
+func (p *Dataset) GetLabelMapper() *LabelMapper {
+	return p.labelMapper
+}
+
+//parseAnnotations parses all annotations of the dataset in parallel
+func (p *Dataset) parseAnnotations(options ObjectOptions) *AnnotationPipeline {
+	return NewAnnotationPipeline(p.GetMirrorDirectory() + "Annotations", p.parseWorkers, func(path string) (Annotation, error) {
+		return parseAnnotationFromXml(path, "", options)
+	})
+}
+
+func printParseErrors(errs []ParseError) {
+	//looks like there are some broken XML files in the label me dataset...those are skipped
+	for _, err := range errs {
+		fmt.Printf("Couldn't parse xml file %s\n", err.Error())
+	}
+	if len(errs) > 0 {
+		fmt.Printf("skipped %d xml files\n", len(errs))
+	}
+}
+
+func (p *Dataset) getManifestPath() string {
+	return p.baseDirectory + "/.mirror-manifest.json"
+}
+
+func (p *Dataset) GetCacheDirectory() string {
+	return p.baseDirectory + "/cache/"
+}
+
+//GetMirrorDirectory returns the directory the LabelMe website is mirrored to
+//(wget -m stores the files under <host>/<path>)
+func (p *Dataset) GetMirrorDirectory() string {
+	u, err := url.Parse(p.baseUrl)
+	if err != nil {
+		return p.baseDirectory + "/"
+	}
+	return p.baseDirectory + "/" + u.Host + u.Path
+}
+
+func (p *Dataset) GetMaskPath(folder string, mask string) string {
+	return p.GetMirrorDirectory() + "Masks/" + folder + "/" + mask
+}
+
+//LoadMask returns the mask image of a segmentation. Masks that aren't mirrored
+//yet are downloaded from the Masks/ tree.
+func (p *Dataset) LoadMask(folder string, mask string) (image.Image, error) {
+	return p.LoadMaskContext(context.Background(), folder, mask)
+}
+
+//LoadMaskContext is LoadMask with a context that cancels the download of the mask
+func (p *Dataset) LoadMaskContext(ctx context.Context, folder string, mask string) (image.Image, error) {
+	path := p.GetMaskPath(folder, mask)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		err = downloadImageWithRetries(ctx, p.httpClient, p.baseUrl + "Masks/" + folder + "/" + mask, path, p.downloadOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+//ResolveMasks traces the masks of all objects that were annotated with the brush
+//tool (and therefore don't have a polygon) and stores the result in MaskPolygons
+func (p *Dataset) ResolveMasks(annotation *Annotation) error {
+	return p.ResolveMasksContext(context.Background(), annotation)
+}
+
+//ResolveMasksContext is ResolveMasks with a context that cancels the download of the masks
+func (p *Dataset) ResolveMasksContext(ctx context.Context, annotation *Annotation) error {
+	folder := strings.Trim(annotation.Folder, "\r\n")
+	for i := range annotation.Objects {
+		object := &annotation.Objects[i]
+		maskName := strings.TrimSpace(object.Segment.Mask)
+		if len(object.Polygon.Points) >= 3 || maskName == "" {
+			continue
+		}
+
+		mask, err := p.LoadMaskContext(ctx, folder, maskName)
+		if err != nil {
+			return fmt.Errorf("couldn't load mask %s: %s", maskName, err.Error())
+		}
+
+		//masks usually only cover the bounding box of the object
+		var offset image.Point
+		bounds := mask.Bounds()
+		if !annotation.HasImageSize() || int32(bounds.Dx()) != annotation.ImageSize.NCols || int32(bounds.Dy()) != annotation.ImageSize.NRows {
+			offset = image.Point{X: int(object.Segment.Box.Xmin), Y: int(object.Segment.Box.Ymin)}
+		}
+		object.MaskPolygons = MaskToPolygons(mask, offset)
+	}
+
+	return nil
+}
+
+//MirrorMasks mirrors the complete Masks/ tree. Usually that isn't necessary, as
+//LoadMask downloads missing masks on demand.
+func (p *Dataset) MirrorMasks() (MirrorResult, error) {
+	return p.MirrorMasksContext(context.Background())
+}
+
+//MirrorMasksContext is MirrorMasks with a context
+func (p *Dataset) MirrorMasksContext(ctx context.Context) (MirrorResult, error) {
+	manifest, err := readManifest(p.getManifestPath())
+	if err != nil {
+		return MirrorResult{}, err
+	}
+
+	mirror := NewMirror(p.baseUrl, p.GetMirrorDirectory(), manifest, p.mirrorConcurrency)
+	return mirror.MirrorContext(ctx, "Masks/")
+}
+
+func (p *Dataset) GetAnnotationPath(imageInfo ImageInfo) string {
+	filename := strings.TrimSuffix(imageInfo.Filename, filepath.Ext(imageInfo.Filename)) + ".xml"
+	return p.GetMirrorDirectory() + "Annotations/" + imageInfo.Folder + "/" + filename
+}
+
+func (p *Dataset) BuildLabelMap() error {
+	if p.HasIndex() {
+		index, err := p.openIndex()
+		if err != nil {
+			return err
+		}
+		defer index.Close()
+
+		p.labels, err = index.LabelMap(p.objectOptions)
+		return err
+	}
+
+	cachedLabelsMapDir := p.GetCacheDirectory()
+	cachedLabelsMapPath := cachedLabelsMapDir + "labels" + p.objectOptions.cacheSuffix() + ".map"
+
+	//if cache is enabled
+	if p.useCache {
+		err := os.MkdirAll(cachedLabelsMapDir, 0755)
+		if err != nil {
+			return err
+		}
+
+
+		//check if labels map file exists
+		if _, err := os.Stat(cachedLabelsMapPath); err == nil {
+			//if file exists..read it and we are done here.
+			fmt.Println("found cached label map...using this one")
+			p.labels, err = readCachedLabelMap(cachedLabelsMapPath)
+			return err
+		}
+	}
+
+	//the map is built from scratch, so that calling BuildLabelMap again doesn't count the objects twice
+	labels := make(map[string]int32)
+	pipeline := p.parseAnnotations(p.objectOptions)
+	for parsed := range pipeline.Results() {
+        for _, object := range parsed.Annotation.Objects {
+        	labels[object.Name]++
+        }
+	}
+	printParseErrors(pipeline.Errors())
+	p.labels = labels
+
+	if p.useCache {
+		return persistLabelMap(cachedLabelsMapPath, p.labels)
+	}
+
+	return nil
+}
+
+//GetLabelMap returns the number of objects per LabelMe name
+func (p *Dataset) GetLabelMap() map[string]int32 {
+	return p.labels
+}
+
+//Name returns the name of the source, see source.Register
+func (p *Dataset) Name() string {
+	return "labelme"
+}
+
+//Labels returns the number of objects per LabelMe name. With a filter, only the
+//objects matching the filter are counted (which requires parsing all annotations).
+func (p *Dataset) Labels(ctx context.Context, filter *ObjectFilter) (map[string]int32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if filter != nil {
+		return p.BuildFilteredLabelMap(filter), nil
+	}
+
+	err := p.BuildLabelMap()
+	if err != nil {
+		return nil, err
+	}
+	return p.GetLabelMap(), nil
+}
+
+//GetMappedLabelMap returns the number of objects per ImageMonkey label
+func (p *Dataset) GetMappedLabelMap() map[string]int32 {
+	return p.labelMapper.MapLabelMap(p.labels)
+}
+
+//GetImageInfos returns the images that contain objects which are mapped to the
+//given ImageMonkey label
+func (p *Dataset) GetImageInfos(label string) ([]ImageInfo, error) {
+	if p.HasIndex() {
+		return p.QueryImageInfos(IndexQuery{Label: label})
+	}
+
+	cachedImageInfosDir := p.GetCacheDirectory()
+	cachedImageInfos := cachedImageInfosDir + p.labelMapper.MapLabel(label) + p.objectOptions.cacheSuffix() + p.labelMapper.cacheSuffix() + ".tmp"
+
+	var imageInfos []ImageInfo
+
+	if p.useCache {
+		err := os.MkdirAll(cachedImageInfosDir, 0755)
+		if err != nil {
+			return imageInfos, err
+		}
+
+		//check if file exists
+		if _, err := os.Stat(cachedImageInfos); err == nil {
+			//if file exists..read it and we are done here.
+			fmt.Println("found cached image infos...using this one")
+			imageInfos, err = readCachedImageInfos(cachedImageInfos)
+			return p.filterImageExceptions(imageInfos), err
+		}
+
+	}
+
+	imageInfos = p.collectImageInfos(func(annotation Annotation) bool {
+		for _, object := range annotation.Objects {
+			if p.labelMapper.Is(object.Name, label) {
+				return true
+			}
+		}
+		return false
+	})
+
+	//the cache contains all images, so that changed exceptions apply immediately
+	if p.useCache {
+		err := persistImageInfos(cachedImageInfos, imageInfos)
+		return p.filterImageExceptions(imageInfos), err
+	}
+
+	return p.filterImageExceptions(imageInfos), nil
+} 
+
+//FindImageInfos returns the images that contain at least one object matching the filter.
+//The filter is evaluated on the parsed annotations, neither the index nor the cache is used.
+func (p *Dataset) FindImageInfos(filter *ObjectFilter) []ImageInfo {
+	return p.filterImageExceptions(p.collectImageInfos(func(annotation Annotation) bool {
+		return annotation.HasMatchingObject(filter)
+	}))
+}
+
+//collectImageInfos parses all annotations and returns the (deduplicated) images
+//of the annotations for which match returns true, sorted by unique name
+func (p *Dataset) collectImageInfos(match func(Annotation) bool) []ImageInfo {
+	var imageInfos []ImageInfo
+	filenameExistsMap := map[string]bool{}
+
+	pipeline := p.parseAnnotations(p.objectOptions)
+	for parsed := range pipeline.Results() {
+		annotation := parsed.Annotation
+		if !match(annotation) {
+			continue
+		}
+
+		imageInfo := imageInfoFromAnnotation(annotation)
+
+		fullname := imageInfo.Folder + "/" + imageInfo.Filename
+		_, exists := filenameExistsMap[fullname]
+		if !exists {
+			imageInfos = append(imageInfos, imageInfo)
+			filenameExistsMap[fullname] = true
+		}
+	}
+	printParseErrors(pipeline.Errors())
+
+	//the annotations are parsed in parallel, so bring the result into a stable order
+	sort.Slice(imageInfos, func(i, j int) bool {
+		return imageInfos[i].UniqueName < imageInfos[j].UniqueName
+	})
+
+	return imageInfos
+}
+
+//BuildFilteredLabelMap counts the objects per label, only objects that match the filter are counted
+func (p *Dataset) BuildFilteredLabelMap(filter *ObjectFilter) map[string]int32 {
+	labelMap := make(map[string]int32)
+
+	pipeline := p.parseAnnotations(p.objectOptions)
+	for parsed := range pipeline.Results() {
+		for _, object := range parsed.Annotation.Objects {
+			if filter.Match(object) {
+				labelMap[object.Name] += 1
+			}
+		}
+	}
+	printParseErrors(pipeline.Errors())
+
+	return labelMap
+}
+
+func (p *Dataset) DownloadImage(name string, filename string) (error) {
+	return p.DownloadImageContext(context.Background(), name, filename)
+}
+
+//DownloadImageContext is DownloadImage with a context that cancels the download (and its retries)
+func (p *Dataset) DownloadImageContext(ctx context.Context, name string, filename string) error {
+	url := p.baseUrl + "Images/" + name
+	return downloadImageWithRetries(ctx, p.httpClient, url, filename, p.downloadOptions)
+}
+
+func (p *Dataset) DownloadImages(imageInfos []ImageInfo, label string) (error) {
+	return p.DownloadImagesContext(context.Background(), imageInfos, label)
+}
+
+//DownloadImagesContext is DownloadImages with a context. When the context is
+//cancelled, no further downloads are started; the next call resumes.
+func (p *Dataset) DownloadImagesContext(ctx context.Context, imageInfos []ImageInfo, label string) error {
+	dir := p.GetCacheDirectory() + label
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]DownloadJob, 0, len(imageInfos))
+	for _, imageInfo := range p.filterImageExceptions(imageInfos) {
+		name := convertToLocalFilename(imageInfo.Folder, imageInfo.Filename)
+		jobs = append(jobs, DownloadJob{
+			Url: p.baseUrl + "Images/" + imageInfo.Folder + "/" + imageInfo.Filename,
+			Path: dir + "/" + name,
+			Name: name,
+		})
+	}
+
+	return DownloadJobs(ctx, p.httpClient, jobs, p.downloadOptions)
+}
+
+//OpenImageContext decodes the image file and, if requested, scales it down to the size
+//that is donated. The Url of the image isn't set.
+func OpenImageContext(ctx context.Context, path string, scaled bool) (Image, error) {
+	if err := ctx.Err(); err != nil {
+		return Image{}, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return Image{}, err
+	}
+	defer f.Close()
+
+	return DecodeImageContext(ctx, f, scaled)
+}
+
+//DecodeImageContext is OpenImageContext for images that aren't stored in a file
+func DecodeImageContext(ctx context.Context, r io.Reader, scaled bool) (Image, error) {
+	var im Image
+	if err := ctx.Err(); err != nil {
+		return im, err
+	}
+
+	var err error
+	im.OriginalImage, _, err = image.Decode(r)
+	if err != nil {
+		return im, err
+	}
+
+	bounds := im.OriginalImage.Bounds()
+	im.OriginalWidth = int32(bounds.Dx())
+	im.OriginalHeight = int32(bounds.Dy())
+
+	if scaled {
+		if err := ctx.Err(); err != nil {
+			return im, err
+		}
+		im.ScaleFactor = calcScaleFactor(im)
+		im.ScaledWidth = int32(float32(im.OriginalWidth) * im.ScaleFactor)
+		im.ScaledHeight = int32(float32(im.OriginalHeight) * im.ScaleFactor)
+
+		im.ScaledImage = resize.Resize(uint(im.ScaledWidth), uint(im.ScaledHeight), im.OriginalImage, resize.Lanczos3)
+	} else {
+		im.ScaleFactor = 1.0
+		im.ScaledWidth = im.OriginalWidth
+		im.ScaledHeight = im.OriginalHeight
+		im.ScaledImage = im.OriginalImage
+	}
+
+	return im, nil
+}
+
+func (p *Dataset) GetImage(label string, imageInfo ImageInfo, scaled bool) (Image, error) {
+	return p.GetImageContext(context.Background(), label, imageInfo, scaled)
+}
+
+//GetImageContext is GetImage with a context. Decoding and scaling can't be interrupted,
+//the context is checked before each of them.
+func (p *Dataset) GetImageContext(ctx context.Context, label string, imageInfo ImageInfo, scaled bool) (Image, error) {
+	if p.useCache {
+		im, err := OpenImageContext(ctx, p.GetCacheDirectory() + label + "/" + imageInfo.UniqueName, scaled)
+		if err != nil {
+			return im, err
+		}
+		im.Url = p.baseUrl + "Images/" + imageInfo.Folder + "/" + imageInfo.Filename
+		return im, nil
+	}
+
+	return Image{}, errors.New("LabelMeConverter: Currently only the cached version of this call is implemented")
+}
+
+
+func (p *Dataset) ParseAnnotationFromXml(filename string, label string) (Annotation, error) {
+	return parseAnnotationFromXml(filename, label, p.objectOptions)
+}
+
+//ParseAnnotationWithFilter parses the annotation and only keeps the objects that match the filter
+func (p *Dataset) ParseAnnotationWithFilter(filename string, filter *ObjectFilter) (Annotation, error) {
+	annotation, err := parseAnnotationFromXml(filename, "", p.objectOptions)
+	if err != nil {
+		return annotation, err
+	}
+	annotation.FilterObjects(filter)
+	return annotation, nil
+}
+
+//GetAnnotationContext returns the annotation of the image, only with the objects that
+//match the filter. The masks of brush annotations aren't resolved, see ResolveMasksContext.
+func (p *Dataset) GetAnnotationContext(ctx context.Context, imageInfo ImageInfo, filter *ObjectFilter) (Annotation, error) {
+	if err := ctx.Err(); err != nil {
+		return Annotation{}, err
+	}
+	return p.ParseAnnotationWithFilter(p.GetAnnotationPath(imageInfo), filter)
+}
+
+func parseAnnotationFromXml(filename string, label string, options ObjectOptions) (Annotation, error) {
+	var annotation Annotation
+	f, err := os.Open(filename)
+	if err != nil {
+		return annotation, err
+	}
+	defer f.Close()
+
+	
+	err = xml.NewDecoder(f).Decode(&annotation)
+	if err != nil {
+		return annotation, err
+	}
+
+	//drop deleted (and optionally unverified) objects
+	kept := make([]Object, 0, len(annotation.Objects))
+	for _, object := range annotation.Objects {
+		if options.Keep(object) {
+			kept = append(kept, object)
+		}
+	}
+	annotation.Objects = kept
+
+	if label != "" { //only keep objects where label matches
+		var objects []Object
+		objects = make([]Object, 0) //empty slice 
+		for _, object := range annotation.Objects {
+			if label != object.Name {
+				continue
+			}
+
+			objects = append(objects, object)
+		}
+		annotation.Objects = objects
+	}
+
+	return annotation, nil
+}
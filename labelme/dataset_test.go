@@ -0,0 +1,43 @@
+package labelme
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testAnnotation = `<annotation>
+<filename>img1.jpg</filename>
+<folder>folder</folder>
+<imagesize><nrows>100</nrows><ncols>100</ncols></imagesize>
+<object><name>car</name><deleted>0</deleted><polygon><pt><x>1</x><y>1</y></pt><pt><x>20</x><y>1</y></pt><pt><x>20</x><y>20</y></pt></polygon></object>
+<object><name>car</name><deleted>0</deleted><polygon><pt><x>30</x><y>30</y></pt><pt><x>50</x><y>30</y></pt><pt><x>50</x><y>50</y></pt></polygon></object>
+<object><name>person</name><deleted>0</deleted><polygon><pt><x>60</x><y>60</y></pt><pt><x>90</x><y>60</y></pt><pt><x>90</x><y>90</y></pt></polygon></object>
+</annotation>`
+
+func TestDatasetLabelsTwice(t *testing.T) {
+	dataset := NewDataset(t.TempDir(), false)
+	dir := filepath.Join(dataset.GetMirrorDirectory(), "Annotations", "folder")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "img1.xml"), []byte(testAnnotation), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int32{"car": 2, "person": 1}
+	for i := 0; i < 2; i++ {
+		labels, err := dataset.Labels(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(labels, want) {
+			t.Errorf("call %d: got labels %v, want %v", i + 1, labels, want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package labelme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type DownloadOptions struct {
+	//number of images that are downloaded in parallel
+	Parallelism int
+	//number of retries per image, in case of network errors or server errors
+	Retries int
+	//backoff before the first retry, doubled for every further retry
+	Backoff time.Duration
+}
+
+func DefaultDownloadOptions() DownloadOptions {
+	return DownloadOptions{
+		Parallelism: 4,
+		Retries: 3,
+		Backoff: 1 * time.Second,
+	}
+}
+
+type StatusError struct {
+	Url string
+	StatusCode int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return e.Url + ": unexpected status " + e.Status
+}
+
+//isRetryable returns false for errors that won't go away by trying again
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	var contentErr *ContentError
+	if errors.As(err, &contentErr) {
+		return false
+	}
+	return true
+}
+
+type ContentError struct {
+	Url string
+	Reason string
+}
+
+func (e *ContentError) Error() string {
+	return e.Url + ": " + e.Reason
+}
+
+//verifyImage checks that the file at path is an image that can be decoded
+func verifyImage(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, _, err = image.Decode(f)
+	return err
+}
+
+//isValidImage is a cheaper check than verifyImage, it only decodes the image header
+func isValidImage(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	_, _, err = image.DecodeConfig(f)
+	return err == nil
+}
+
+//downloadImageOnce downloads the image to a temporary file, verifies it and
+//moves it to filename afterwards. So filename either contains a valid image or
+//doesn't exist at all.
+func downloadImageOnce(ctx context.Context, client *http.Client, url string, filename string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return &StatusError{Url: url, StatusCode: response.StatusCode, Status: response.Status}
+	}
+
+	contentType := response.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return &ContentError{Url: url, Reason: "unexpected content type " + contentType}
+	}
+
+	tmpPath, _, err := writeTempFile(filename, response.Body)
+	if err != nil {
+		return err
+	}
+
+	err = verifyImage(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return &ContentError{Url: url, Reason: "couldn't decode image: " + err.Error()}
+	}
+
+	err = os.Rename(tmpPath, filename)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+//sleepContext sleeps for d or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func downloadImageWithRetries(ctx context.Context, client *http.Client, url string, filename string, options DownloadOptions) error {
+	backoff := options.Backoff
+	var err error
+	for attempt := 0; attempt <= options.Retries; attempt++ {
+		if attempt > 0 {
+			if sleepErr := sleepContext(ctx, backoff); sleepErr != nil {
+				return sleepErr
+			}
+			backoff *= 2
+		}
+
+		err = downloadImageOnce(ctx, client, url, filename)
+		if err == nil || !isRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+//DownloadJob is an image that is downloaded from Url to Path. Name is used in the progress messages.
+type DownloadJob struct {
+	Url string
+	Path string
+	Name string
+}
+
+//DownloadJobs downloads the jobs with a pool of options.Parallelism workers.
+//Images that already exist and can be decoded are skipped. When the context is
+//cancelled, no further downloads are started.
+func DownloadJobs(ctx context.Context, client *http.Client, jobs []DownloadJob, options DownloadOptions) error {
+	parallelism := options.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	var failed []error
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var done int32
+
+	queue := make(chan DownloadJob)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if isValidImage(job.Path) { //skip images that already exist
+					n := atomic.AddInt32(&done, 1)
+					fmt.Printf("[%d/%d] Image exists, skipping: %s\n", n, len(jobs), job.Name)
+					continue
+				}
+
+				err := downloadImageWithRetries(ctx, client, job.Url, job.Path, options)
+				if err != nil && ctx.Err() != nil {
+					continue
+				}
+				n := atomic.AddInt32(&done, 1)
+				if err != nil {
+					fmt.Printf("[%d/%d] Couldn't download image %s: %s\n", n, len(jobs), job.Name, err.Error())
+					mutex.Lock()
+					failed = append(failed, err)
+					mutex.Unlock()
+					continue
+				}
+				fmt.Printf("[%d/%d] Downloaded Image %s\n", n, len(jobs), job.Name)
+			}
+		}()
+	}
+
+feed:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d images couldn't be downloaded (first error: %s)", len(failed), len(jobs), failed[0].Error())
+	}
+	return nil
+}
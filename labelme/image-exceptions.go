@@ -0,0 +1,165 @@
+package labelme
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+//ImageException excludes images from being listed, downloaded and pushed. It either
+//names a single image (UniqueName) or matches images by a glob Pattern on
+//"<folder>/<filename>", e.g. "05june05_static_street_boston/*" for a whole folder.
+type ImageException struct {
+	UniqueName string `json:"uniquename,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (e ImageException) Matches(imageInfo ImageInfo) bool {
+	if e.UniqueName != "" && e.UniqueName == imageInfo.UniqueName {
+		return true
+	}
+	if e.Pattern != "" {
+		matched, _ := path.Match(e.Pattern, imageInfo.Folder + "/" + imageInfo.Filename)
+		return matched
+	}
+	return false
+}
+
+func (e ImageException) String() string {
+	s := e.UniqueName
+	if e.Pattern != "" {
+		s = "pattern " + e.Pattern
+	}
+	if e.Reason != "" {
+		s += " (" + e.Reason + ")"
+	}
+	return s
+}
+
+func (e ImageException) validate() error {
+	if (e.UniqueName == "") == (e.Pattern == "") {
+		return errors.New("an exception needs either an image or a pattern")
+	}
+	if e.Pattern != "" {
+		if _, err := path.Match(e.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %s: %s", e.Pattern, err.Error())
+		}
+	}
+	return nil
+}
+
+func persistImageExceptions(path string, exceptions []ImageException) error {
+	bytes, err := json.MarshalIndent(exceptions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	//write to a temporary file first, so that a crash doesn't lose the exceptions
+	err = ioutil.WriteFile(path + ".part", bytes, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path + ".part", path)
+}
+
+func (p *Dataset) getImageExceptionsPath() string {
+	return p.GetCacheDirectory() + "exceptions.tmp"
+}
+
+//LoadImageExceptions reads the image exceptions of the dataset (if there are any)
+func (p *Dataset) LoadImageExceptions() error {
+	imageExceptionsPath := p.getImageExceptionsPath()
+	if _, err := os.Stat(imageExceptionsPath); err == nil { //if image exceptions exist
+		fmt.Println("exceptions file exists...using this one")
+		p.imageExceptions, err = readImageExceptions(imageExceptionsPath)
+		if err != nil {
+			return fmt.Errorf("couldn't read image exceptions: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+func (p *Dataset) GetImageExceptions() []ImageException {
+	return p.imageExceptions
+}
+
+//GetImageException returns the exception that excludes the image, if any
+func (p *Dataset) GetImageException(imageInfo ImageInfo) (ImageException, bool) {
+	for _, exception := range p.imageExceptions {
+		if exception.Matches(imageInfo) {
+			return exception, true
+		}
+	}
+	return ImageException{}, false
+}
+
+//filterImageExceptions removes the images that are excluded by an exception
+func (p *Dataset) filterImageExceptions(imageInfos []ImageInfo) []ImageInfo {
+	if len(p.imageExceptions) == 0 {
+		return imageInfos
+	}
+
+	filtered := make([]ImageInfo, 0, len(imageInfos))
+	for _, imageInfo := range imageInfos {
+		if _, ok := p.GetImageException(imageInfo); !ok {
+			filtered = append(filtered, imageInfo)
+		}
+	}
+	if len(filtered) < len(imageInfos) {
+		fmt.Printf("excluded %d images because of image exceptions\n", len(imageInfos) - len(filtered))
+	}
+	return filtered
+}
+
+//AddImageException adds the exception and persists the exceptions. An existing
+//exception for the same image or pattern is replaced (e.g. to update the reason).
+func (p *Dataset) AddImageException(exception ImageException) error {
+	err := exception.validate()
+	if err != nil {
+		return err
+	}
+
+	exceptions := make([]ImageException, 0, len(p.imageExceptions) + 1)
+	for _, e := range p.imageExceptions {
+		if e.UniqueName != exception.UniqueName || e.Pattern != exception.Pattern {
+			exceptions = append(exceptions, e)
+		}
+	}
+	exceptions = append(exceptions, exception)
+
+	err = os.MkdirAll(p.GetCacheDirectory(), 0755)
+	if err != nil {
+		return err
+	}
+	err = persistImageExceptions(p.getImageExceptionsPath(), exceptions)
+	if err != nil {
+		return err
+	}
+	p.imageExceptions = exceptions
+	return nil
+}
+
+//RemoveImageException removes the exception of the given image or pattern and
+//persists the exceptions. It returns false if there was no such exception.
+func (p *Dataset) RemoveImageException(uniqueName string, pattern string) (bool, error) {
+	exceptions := make([]ImageException, 0, len(p.imageExceptions))
+	for _, e := range p.imageExceptions {
+		if e.UniqueName != uniqueName || e.Pattern != pattern {
+			exceptions = append(exceptions, e)
+		}
+	}
+	if len(exceptions) == len(p.imageExceptions) {
+		return false, nil
+	}
+
+	err := persistImageExceptions(p.getImageExceptionsPath(), exceptions)
+	if err != nil {
+		return false, err
+	}
+	p.imageExceptions = exceptions
+	return true, nil
+}
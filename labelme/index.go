@@ -0,0 +1,297 @@
+package labelme
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	_ "modernc.org/sqlite"
+)
+
+//indexSchemaVersion is increased whenever the schema or the indexed values change,
+//so that outdated indexes are detected
+const indexSchemaVersion = "3"
+
+const indexSchema = `
+DROP TABLE IF EXISTS polygon_points;
+DROP TABLE IF EXISTS objects;
+DROP TABLE IF EXISTS annotations;
+DROP TABLE IF EXISTS labels;
+DROP TABLE IF EXISTS meta;
+
+CREATE TABLE annotations (
+	id INTEGER PRIMARY KEY,
+	path TEXT NOT NULL UNIQUE,
+	folder TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	unique_name TEXT NOT NULL,
+	nrows INTEGER NOT NULL,
+	ncols INTEGER NOT NULL,
+	source_image TEXT NOT NULL,
+	source_annotation TEXT NOT NULL
+);
+
+CREATE TABLE objects (
+	id INTEGER PRIMARY KEY,
+	annotation_id INTEGER NOT NULL REFERENCES annotations(id) ON DELETE CASCADE,
+	lm_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	deleted INTEGER NOT NULL,
+	verified INTEGER NOT NULL,
+	occluded INTEGER NOT NULL,
+	attributes TEXT NOT NULL,
+	has_parts TEXT NOT NULL,
+	is_part_of TEXT NOT NULL,
+	date TEXT NOT NULL,
+	username TEXT NOT NULL
+);
+
+CREATE TABLE polygon_points (
+	object_id INTEGER NOT NULL REFERENCES objects(id) ON DELETE CASCADE,
+	idx INTEGER NOT NULL,
+	x INTEGER NOT NULL,
+	y INTEGER NOT NULL,
+	PRIMARY KEY (object_id, idx)
+);
+
+CREATE TABLE labels (
+	name TEXT PRIMARY KEY,
+	num INTEGER NOT NULL
+);
+
+CREATE TABLE meta (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE INDEX objects_name_idx ON objects(name);
+CREATE INDEX objects_annotation_id_idx ON objects(annotation_id);
+CREATE INDEX annotations_folder_idx ON annotations(folder);
+`
+
+//IndexQuery selects images from the index. Empty fields are ignored.
+type IndexQuery struct {
+	//name of an object in the image
+	Label string
+	//names of objects in the image, an image matches if it contains any of them
+	Names []string
+	//LabelMe folder the image belongs to
+	Folder string
+	//substring of the attributes of an object in the image (combined with Label,
+	//the attributes of the object with that label have to match)
+	Attribute string
+	//which objects are considered (deleted/unverified)
+	ObjectOptions ObjectOptions
+}
+
+func (o ObjectOptions) sqlCondition(alias string) string {
+	var conditions []string
+	if !o.IncludeDeleted {
+		conditions = append(conditions, alias + ".deleted = 0")
+	}
+	if o.OnlyVerified {
+		conditions = append(conditions, alias + ".verified = 1")
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+//Index is an on-disk SQLite index of the parsed LabelMe annotations
+type Index struct {
+	db *sql.DB
+}
+
+func OpenIndex(path string) (*Index, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec("PRAGMA foreign_keys = ON")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Index{db: db}, nil
+}
+
+//Verify checks that the index was built with the current schema
+func (p *Index) Verify() error {
+	var version string
+	err := p.db.QueryRow("SELECT value FROM meta WHERE key = 'schema_version'").Scan(&version)
+	if err != nil || version != indexSchemaVersion {
+		return errors.New("index is outdated, run the index command again")
+	}
+	return nil
+}
+
+func (p *Index) Close() error {
+	return p.db.Close()
+}
+
+//Rebuild drops the existing index and fills it with the given annotations.
+//Everything happens in a single transaction, so a failed rebuild keeps the old index.
+func (p *Index) Rebuild(annotations <-chan ParsedAnnotation) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(indexSchema)
+	if err != nil {
+		return err
+	}
+
+	insertAnnotation, err := tx.Prepare(`INSERT INTO annotations(path, folder, filename, unique_name, nrows, ncols, source_image, source_annotation)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertAnnotation.Close()
+
+	insertObject, err := tx.Prepare(`INSERT INTO objects(annotation_id, lm_id, name, deleted, verified, occluded, attributes, has_parts, is_part_of, date, username)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertObject.Close()
+
+	insertPoint, err := tx.Prepare("INSERT INTO polygon_points(object_id, idx, x, y) VALUES(?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertPoint.Close()
+
+	for parsed := range annotations {
+		annotation := parsed.Annotation
+		imageInfo := imageInfoFromAnnotation(annotation)
+		res, err := insertAnnotation.Exec(parsed.Path, imageInfo.Folder, imageInfo.Filename, imageInfo.UniqueName,
+			annotation.ImageSize.NRows, annotation.ImageSize.NCols,
+			strings.TrimSpace(annotation.Source.SourceImage), strings.TrimSpace(annotation.Source.SourceAnnotation))
+		if err != nil {
+			return err
+		}
+		annotationId, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		for _, object := range annotation.Objects {
+			res, err = insertObject.Exec(annotationId, object.GetId(), object.Name, object.Deleted, object.Verified, object.IsOccluded(),
+				strings.TrimSpace(object.Attributes), strings.Join(object.PartIds(), ","), object.ParentId(),
+				strings.TrimSpace(object.Date), object.GetUsername())
+			if err != nil {
+				return err
+			}
+			objectId, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+
+			for i, point := range object.Polygon.Points {
+				_, err = insertPoint.Exec(objectId, i, point.X, point.Y)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO labels(name, num) SELECT name, COUNT(*) FROM objects WHERE deleted = 0 GROUP BY name")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO meta(key, value) VALUES('built_at', ?), ('schema_version', ?)", time.Now().Format(time.RFC3339), indexSchemaVersion)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//LabelMap returns the number of objects per label. The precomputed label counts
+//are used for the default options.
+func (p *Index) LabelMap(options ObjectOptions) (map[string]int32, error) {
+	labelMap := make(map[string]int32)
+
+	q := "SELECT name, num FROM labels"
+	if options != DefaultObjectOptions() {
+		q = "SELECT o.name, COUNT(*) FROM objects o"
+		if condition := options.sqlCondition("o"); condition != "" {
+			q += " WHERE " + condition
+		}
+		q += " GROUP BY o.name"
+	}
+
+	rows, err := p.db.Query(q)
+	if err != nil {
+		return labelMap, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var num int32
+		err = rows.Scan(&name, &num)
+		if err != nil {
+			return labelMap, err
+		}
+		labelMap[name] = num
+	}
+
+	return labelMap, rows.Err()
+}
+
+func (p *Index) ImageInfos(query IndexQuery) ([]ImageInfo, error) {
+	var imageInfos []ImageInfo
+
+	q := "SELECT DISTINCT a.folder, a.filename, a.unique_name FROM annotations a"
+	var conditions []string
+	var args []interface{}
+	q += " JOIN objects o ON o.annotation_id = a.id"
+	if condition := query.ObjectOptions.sqlCondition("o"); condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if query.Label != "" {
+		conditions = append(conditions, "o.name = ?")
+		args = append(args, query.Label)
+	}
+	if len(query.Names) > 0 {
+		conditions = append(conditions, "o.name IN (?" + strings.Repeat(", ?", len(query.Names)-1) + ")")
+		for _, name := range query.Names {
+			args = append(args, name)
+		}
+	}
+	if query.Attribute != "" {
+		conditions = append(conditions, "instr(o.attributes, ?) > 0")
+		args = append(args, query.Attribute)
+	}
+	if query.Folder != "" {
+		conditions = append(conditions, "a.folder = ?")
+		args = append(args, query.Folder)
+	}
+	if len(conditions) > 0 {
+		q += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	//the same order as without the index, see collectImageInfos
+	q += " ORDER BY a.unique_name"
+
+	rows, err := p.db.Query(q, args...)
+	if err != nil {
+		return imageInfos, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var imageInfo ImageInfo
+		err = rows.Scan(&imageInfo.Folder, &imageInfo.Filename, &imageInfo.UniqueName)
+		if err != nil {
+			return imageInfos, err
+		}
+		imageInfos = append(imageInfos, imageInfo)
+	}
+
+	return imageInfos, rows.Err()
+}
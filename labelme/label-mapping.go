@@ -0,0 +1,230 @@
+package labelme
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"gopkg.in/yaml.v3"
+)
+
+//defaultLabelModifiers are words LabelMe users append to object names to describe
+//the state of the object, e.g. "car occluded" or "person crop"
+var defaultLabelModifiers = []string{
+	"occluded", "occlusion", "crop", "cropped", "truncated", "partial", "whole",
+}
+
+//LabelMappingFile is the user-editable mapping from LabelMe object names to
+//ImageMonkey labels, e.g.
+//
+//	modifiers: [occluded, crop]
+//	labels:
+//	  car: [carside, automobile, car frontal]
+type LabelMappingFile struct {
+	//words that are removed from the object names (replaces the default modifiers)
+	Modifiers []string `yaml:"modifiers"`
+	//ImageMonkey label => LabelMe names
+	Labels map[string][]string `yaml:"labels"`
+}
+
+//LabelMapper normalizes LabelMe object names and maps them to ImageMonkey labels
+type LabelMapper struct {
+	modifiers map[string]bool
+	labels map[string]string
+	fingerprint string
+}
+
+func NewLabelMapper(mapping LabelMappingFile) *LabelMapper {
+	modifiers := mapping.Modifiers
+	if modifiers == nil {
+		modifiers = defaultLabelModifiers
+	}
+
+	p := &LabelMapper{
+		modifiers: make(map[string]bool),
+		labels: make(map[string]string),
+	}
+	for _, modifier := range modifiers {
+		p.modifiers[strings.ToLower(strings.TrimSpace(modifier))] = true
+	}
+
+	labels := make([]string, 0, len(mapping.Labels))
+	for label := range mapping.Labels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	h := fnv.New32a()
+	modifierNames := make([]string, 0, len(p.modifiers))
+	for modifier := range p.modifiers {
+		modifierNames = append(modifierNames, modifier)
+	}
+	sort.Strings(modifierNames)
+	fmt.Fprintf(h, "%v", modifierNames)
+	//the cached image infos depend on the normalization as well
+	fmt.Fprintf(h, "%v%v%v", irregularPlurals, pluralOnlyNouns, singularNouns)
+
+	for _, label := range labels {
+		target := strings.TrimSpace(label)
+		p.labels[p.NormalizeLabel(label)] = target
+		for _, name := range mapping.Labels[label] {
+			p.labels[p.NormalizeLabel(name)] = target
+		}
+		fmt.Fprintf(h, "%s=%v;", label, mapping.Labels[label])
+	}
+	p.fingerprint = fmt.Sprintf("%08x", h.Sum32())
+
+	return p
+}
+
+func DefaultLabelMapper() *LabelMapper {
+	return NewLabelMapper(LabelMappingFile{})
+}
+
+func ReadLabelMapper(path string) (*LabelMapper, error) {
+	var mapping LabelMappingFile
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(bytes, &mapping)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse label mapping %s: %s", path, err.Error())
+	}
+
+	return NewLabelMapper(mapping), nil
+}
+
+//irregularPlurals are the plurals singularize can't derive from the suffix
+var irregularPlurals = map[string]string{
+	"people": "person", "men": "man", "women": "woman", "children": "child",
+	"feet": "foot", "teeth": "tooth", "mice": "mouse", "geese": "goose",
+	"knives": "knife", "leaves": "leaf", "shelves": "shelf", "wolves": "wolf",
+	"buses": "bus", "lenses": "lens", "gases": "gas", "cacti": "cactus",
+	"potatoes": "potato", "tomatoes": "tomato", "heroes": "hero",
+	"movies": "movie", "cookies": "cookie", "brownies": "brownie", "zombies": "zombie",
+	"calories": "calorie", "hoodies": "hoodie", "selfies": "selfie", "goalies": "goalie",
+}
+
+//irregularSingulars are the singular forms of irregularPlurals, they are kept as they
+//are (e.g. lens isn't folded into len)
+var irregularSingulars = func() map[string]bool {
+	singulars := make(map[string]bool)
+	for _, singular := range irregularPlurals {
+		singulars[singular] = true
+	}
+	return singulars
+}()
+
+//singularNouns end in s, but are singular
+var singularNouns = map[string]bool{
+	"canvas": true, "atlas": true, "alias": true, "bias": true, "chaos": true,
+	"cosmos": true, "lens": true, "gas": true, "christmas": true,
+}
+
+//pluralOnlyNouns don't have a singular form (or the singular means something else,
+//e.g. glass), they are kept as they are
+var pluralOnlyNouns = map[string]bool{
+	"glasses": true, "sunglasses": true, "eyeglasses": true, "goggles": true,
+	"jeans": true, "pants": true, "trousers": true, "shorts": true, "tights": true,
+	"pajamas": true, "clothes": true, "scissors": true, "pliers": true, "tongs": true,
+	"binoculars": true, "headphones": true, "earphones": true, "stairs": true,
+	"species": true, "series": true, "news": true, "mathematics": true,
+}
+
+//singularize folds the plural of an english noun into its singular form. Besides
+//the regular forms only the irregular, plural-only and singular nouns listed above
+//are handled, which is good enough for the LabelMe names.
+func singularize(word string) string {
+	if singular, ok := irregularPlurals[word]; ok {
+		return singular
+	}
+	if pluralOnlyNouns[word] || singularNouns[word] || irregularSingulars[word] {
+		return word
+	}
+
+	switch {
+	case len(word) <= 3:
+		return word
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "sses"), strings.HasSuffix(word, "xes"),
+		strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+		return word
+	case strings.HasSuffix(word, "s"):
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
+
+//NormalizeLabel trims and lowercases the name, removes the modifiers and folds
+//the plural of the last word, e.g. "Cars occluded " => "car"
+func (p *LabelMapper) NormalizeLabel(name string) string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '_' || r == ','
+	}) {
+		if !p.modifiers[word] {
+			words = append(words, word)
+		}
+	}
+
+	if len(words) == 0 { //the name only consists of modifiers, keep it
+		return strings.ToLower(strings.TrimSpace(name))
+	}
+
+	words[len(words)-1] = singularize(words[len(words)-1])
+	return strings.Join(words, " ")
+}
+
+//MapLabel returns the ImageMonkey label of a LabelMe object name. Names that aren't
+//in the mapping file are mapped to their normalized form.
+func (p *LabelMapper) MapLabel(name string) string {
+	normalized := p.NormalizeLabel(name)
+	if label, ok := p.labels[normalized]; ok {
+		return label
+	}
+	return normalized
+}
+
+//IsMapped returns true if the name is listed in the mapping file
+func (p *LabelMapper) IsMapped(name string) bool {
+	_, ok := p.labels[p.NormalizeLabel(name)]
+	return ok
+}
+
+//Is returns true if name and label denote the same label
+func (p *LabelMapper) Is(name string, label string) bool {
+	return p.MapLabel(name) == p.MapLabel(label)
+}
+
+//MapLabelMap sums up the counts of all LabelMe names that map to the same label
+func (p *LabelMapper) MapLabelMap(labelMap map[string]int32) map[string]int32 {
+	mapped := make(map[string]int32)
+	for name, num := range labelMap {
+		mapped[p.MapLabel(name)] += num
+	}
+	return mapped
+}
+
+//Names returns the LabelMe names of the label map that map to the given label
+func (p *LabelMapper) Names(labelMap map[string]int32, label string) []string {
+	var names []string
+	for name := range labelMap {
+		if p.Is(name, label) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+//cacheSuffix distinguishes the cached image infos of different mappings
+func (p *LabelMapper) cacheSuffix() string {
+	return ".map-" + p.fingerprint
+}
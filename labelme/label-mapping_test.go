@@ -0,0 +1,167 @@
+package labelme
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSingularize(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"cars", "car"},
+		{"car", "car"},
+		{"bus", "bus"},
+		{"buses", "bus"},
+		{"boxes", "box"},
+		{"benches", "bench"},
+		{"dishes", "dish"},
+		{"classes", "class"},
+		{"bodies", "body"},
+		{"ties", "tie"},
+		{"grass", "grass"},
+		{"cactus", "cactus"},
+		{"axis", "axis"},
+		{"houses", "house"},
+		{"shoes", "shoe"},
+		{"people", "person"},
+		{"women", "woman"},
+		{"knives", "knife"},
+		{"tomatoes", "tomato"},
+		{"glasses", "glasses"},
+		{"sunglasses", "sunglasses"},
+		{"jeans", "jeans"},
+		{"pants", "pants"},
+		{"scissors", "scissors"},
+		{"gas", "gas"},
+		{"lens", "lens"},
+		{"lenses", "lens"},
+		{"movies", "movie"},
+		{"movie", "movie"},
+		{"cookies", "cookie"},
+		{"canvas", "canvas"},
+		{"atlas", "atlas"},
+		{"person", "person"},
+	}
+
+	for _, test := range tests {
+		if got := singularize(test.word); got != test.want {
+			t.Errorf("singularize(%q) = %q, want %q", test.word, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"car", "car"},
+		{"Cars occluded ", "car"},
+		{"  person crop", "person"},
+		{"car_side", "car side"},
+		{"car,occluded", "car"},
+		{"traffic lights", "traffic light"},
+		{"buses", "bus"},
+		{"glasses", "glasses"},
+		{"blue jeans", "blue jeans"},
+		{"occluded", "occluded"},
+		{"Occluded crop", "occluded crop"},
+		{"", ""},
+	}
+
+	mapper := DefaultLabelMapper()
+	for _, test := range tests {
+		if got := mapper.NormalizeLabel(test.name); got != test.want {
+			t.Errorf("NormalizeLabel(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMapLabel(t *testing.T) {
+	mapper := NewLabelMapper(LabelMappingFile{
+		Modifiers: []string{"occluded"},
+		Labels: map[string][]string{
+			"car": {"carside", "automobile", "car frontal"},
+			"Glasses": {"spectacles"},
+		},
+	})
+
+	tests := []struct {
+		name string
+		want string
+		mapped bool
+	}{
+		{"car", "car", true},
+		{"Carside occluded", "car", true},
+		{"automobiles", "car", true},
+		{"car frontal", "car", true},
+		{"car crop", "car crop", false},
+		{"spectacles", "Glasses", true},
+		{"glasses", "Glasses", true},
+		{"buses", "bus", false},
+	}
+
+	for _, test := range tests {
+		if got := mapper.MapLabel(test.name); got != test.want {
+			t.Errorf("MapLabel(%q) = %q, want %q", test.name, got, test.want)
+		}
+		if got := mapper.IsMapped(test.name); got != test.mapped {
+			t.Errorf("IsMapped(%q) = %v, want %v", test.name, got, test.mapped)
+		}
+	}
+}
+
+func TestLabelMapperIs(t *testing.T) {
+	mapper := NewLabelMapper(LabelMappingFile{
+		Labels: map[string][]string{"car": {"carside"}},
+	})
+
+	tests := []struct {
+		name string
+		label string
+		want bool
+	}{
+		{"car", "car", true},
+		{"car", "Car", true},
+		{"cars", "Car", true},
+		{"carside", "Cars", true},
+		{"glasses", "glasses", true},
+		{"glass", "glasses", false},
+		{"buses", "bus", true},
+		{"lens", "lenses", true},
+		{"movies", "movie", true},
+		{"car", "bus", false},
+	}
+
+	for _, test := range tests {
+		if got := mapper.Is(test.name, test.label); got != test.want {
+			t.Errorf("Is(%q, %q) = %v, want %v", test.name, test.label, got, test.want)
+		}
+	}
+}
+
+func TestLabelMapperNames(t *testing.T) {
+	mapper := NewLabelMapper(LabelMappingFile{
+		Labels: map[string][]string{"car": {"carside"}},
+	})
+	labelMap := map[string]int32{"car": 3, "Cars": 2, "carside": 1, "glasses": 4, "glass": 5, "dog": 1}
+
+	tests := []struct {
+		label string
+		want []string
+	}{
+		{"car", []string{"Cars", "car", "carside"}},
+		{"Car", []string{"Cars", "car", "carside"}},
+		{"glasses", []string{"glasses"}},
+		{"glass", []string{"glass"}},
+		{"horse", nil},
+	}
+
+	for _, test := range tests {
+		if got := mapper.Names(labelMap, test.label); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Names(%q) = %v, want %v", test.label, got, test.want)
+		}
+	}
+}
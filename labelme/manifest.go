@@ -0,0 +1,124 @@
+package labelme
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//ManifestEntry contains the metadata of a mirrored file, as reported by the server
+//when the file was downloaded
+type ManifestEntry struct {
+	LastModified string `json:"last_modified,omitempty"`
+	ETag string `json:"etag,omitempty"`
+	Size int64 `json:"size"`
+	//modification time and size shown in the directory listing when the file was
+	//downloaded, a sync skips the file as long as the listing shows the same
+	Listing *ManifestEntry `json:"listing,omitempty"`
+}
+
+func manifestEntryFromResponse(resp *http.Response, size int64) ManifestEntry {
+	return ManifestEntry{
+		LastModified: resp.Header.Get("Last-Modified"),
+		ETag: resp.Header.Get("ETag"),
+		Size: size,
+	}
+}
+
+//Matches returns true if both entries describe the same version of a file
+func (e ManifestEntry) Matches(other ManifestEntry) bool {
+	if e.ETag != "" && other.ETag != "" {
+		return e.ETag == other.ETag
+	}
+	if e.LastModified != "" && other.LastModified != "" {
+		return e.LastModified == other.LastModified && e.Size == other.Size
+	}
+	return false
+}
+
+//Manifest keeps track of the files of the local mirror. The keys are the paths
+//relative to the mirror directory (e.g. "Annotations/folder/file.xml").
+type Manifest struct {
+	path string
+	mutex sync.Mutex
+	Entries map[string]ManifestEntry `json:"entries"`
+}
+
+func readManifest(path string) (*Manifest, error) {
+	manifest := &Manifest{path: path, Entries: make(map[string]ManifestEntry)}
+
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+
+	err = json.Unmarshal(bytes, manifest)
+	if err != nil {
+		return manifest, err
+	}
+	if manifest.Entries == nil {
+		manifest.Entries = make(map[string]ManifestEntry)
+	}
+
+	return manifest, nil
+}
+
+func (p *Manifest) Get(name string) (ManifestEntry, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	entry, ok := p.Entries[name]
+	return entry, ok
+}
+
+func (p *Manifest) Set(name string, entry ManifestEntry) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Entries[name] = entry
+}
+
+func (p *Manifest) Delete(name string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.Entries, name)
+}
+
+//Names returns the sorted names of all entries that start with prefix
+func (p *Manifest) Names(prefix string) []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var names []string
+	for name := range p.Entries {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *Manifest) Persist() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	bytes, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	//write to a temporary file first, so that a crash never leaves a broken manifest behind
+	tmpPath := p.path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, bytes, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, p.path)
+}
@@ -0,0 +1,345 @@
+package labelme
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+//minimum number of pixels of a mask region, smaller regions are treated as noise
+const minMaskRegionSize = 16
+
+//maximum distance (in pixels) of a removed contour point to the simplified polygon
+const contourSimplifyEpsilon = 1.5
+
+//Moore neighborhood in clockwise order, starting west
+var mooreNeighborhood = [8]image.Point{
+	{-1, 0}, {-1, -1}, {0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1},
+}
+
+//4-neighborhood, the background around 8-connected regions is 4-connected
+var fourNeighborhood = [4]image.Point{
+	{-1, 0}, {0, -1}, {1, 0}, {0, 1},
+}
+
+//binaryMask contains the region id of every pixel (0 = background)
+type binaryMask struct {
+	width int
+	height int
+	regions []int
+}
+
+func (m *binaryMask) at(x int, y int) int {
+	if x < 0 || y < 0 || x >= m.width || y >= m.height {
+		return 0
+	}
+	return m.regions[y*m.width+x]
+}
+
+//isForeground returns true for the pixels that belong to the object. LabelMe masks
+//are black/white images, the object is white.
+func isForeground(img image.Image, x int, y int) bool {
+	r, g, b, a := img.At(x, y).RGBA()
+	if a == 0 {
+		return false
+	}
+	return (r+g+b)/3 > 0x7fff
+}
+
+//labelRegions finds the 8-connected foreground regions of the mask and returns
+//the mask together with the size of every region (indexed by region id)
+func labelRegions(img image.Image) (*binaryMask, []int) {
+	bounds := img.Bounds()
+	mask := &binaryMask{width: bounds.Dx(), height: bounds.Dy()}
+	mask.regions = make([]int, mask.width*mask.height)
+
+	foreground := make([]bool, mask.width*mask.height)
+	for y := 0; y < mask.height; y++ {
+		for x := 0; x < mask.width; x++ {
+			foreground[y*mask.width+x] = isForeground(img, bounds.Min.X+x, bounds.Min.Y+y)
+		}
+	}
+
+	sizes := []int{0}
+	for start := range foreground {
+		if !foreground[start] || mask.regions[start] != 0 {
+			continue
+		}
+
+		region := len(sizes)
+		size := 0
+		stack := []int{start}
+		mask.regions[start] = region
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			size++
+
+			x, y := i%mask.width, i/mask.width
+			for _, d := range mooreNeighborhood {
+				nx, ny := x+d.X, y+d.Y
+				if nx < 0 || ny < 0 || nx >= mask.width || ny >= mask.height {
+					continue
+				}
+				j := ny*mask.width + nx
+				if foreground[j] && mask.regions[j] == 0 {
+					mask.regions[j] = region
+					stack = append(stack, j)
+				}
+			}
+		}
+		sizes = append(sizes, size)
+	}
+
+	return mask, sizes
+}
+
+//labelHoles finds the holes of the regions: the 4-connected background areas that
+//don't touch the border of the mask. It returns the holes as a mask of hole ids,
+//the size of every hole and the region that encloses it (both indexed by hole id).
+func labelHoles(mask *binaryMask) (*binaryMask, []int, []int) {
+	holes := &binaryMask{width: mask.width, height: mask.height}
+	holes.regions = make([]int, mask.width*mask.height)
+
+	sizes := []int{0}
+	enclosing := []int{0}
+	visited := make([]bool, mask.width*mask.height)
+	for start := range mask.regions {
+		if mask.regions[start] != 0 || visited[start] {
+			continue
+		}
+
+		var pixels []int
+		border := false
+		stack := []int{start}
+		visited[start] = true
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			pixels = append(pixels, i)
+
+			x, y := i%mask.width, i/mask.width
+			if x == 0 || y == 0 || x == mask.width-1 || y == mask.height-1 {
+				border = true
+			}
+			for _, d := range fourNeighborhood {
+				nx, ny := x+d.X, y+d.Y
+				if nx < 0 || ny < 0 || nx >= mask.width || ny >= mask.height {
+					continue
+				}
+				j := ny*mask.width + nx
+				if mask.regions[j] == 0 && !visited[j] {
+					visited[j] = true
+					stack = append(stack, j)
+				}
+			}
+		}
+		if border {
+			continue
+		}
+
+		hole := len(sizes)
+		for _, i := range pixels {
+			holes.regions[i] = hole
+		}
+		sizes = append(sizes, len(pixels))
+		//start is the first pixel of the hole in raster order, so the pixel west of it
+		//belongs to the region around the hole
+		enclosing = append(enclosing, mask.regions[start-1])
+	}
+
+	return holes, sizes, enclosing
+}
+
+//traceContour traces the outer boundary of the region with Moore-neighbor tracing.
+//start has to be the first pixel of the region in raster order.
+func traceContour(mask *binaryMask, region int, start image.Point) []image.Point {
+	var contour []image.Point
+
+	//the pixel west of start is background, as start is the first pixel in raster order
+	current := start
+	backtrack := 0
+	var second image.Point
+	haveSecond := false
+	maxSteps := 4 * mask.width * mask.height
+
+	for step := 0; step < maxSteps; step++ {
+		found := false
+		var next image.Point
+		for i := 1; i <= 8; i++ {
+			d := (backtrack + i) % 8
+			next = current.Add(mooreNeighborhood[d])
+			if mask.at(next.X, next.Y) == region {
+				//the new backtrack is the neighbor checked right before next, seen from next
+				prev := current.Add(mooreNeighborhood[(d+7)%8])
+				backtrack = directionIndex(prev.Sub(next))
+				found = true
+				break
+			}
+		}
+
+		if !found { //single pixel region
+			break
+		}
+
+		//stop as soon as the trace would repeat the first step
+		if current == start {
+			if haveSecond && next == second {
+				break
+			}
+			if !haveSecond {
+				second = next
+				haveSecond = true
+			}
+		}
+
+		contour = append(contour, current)
+		current = next
+	}
+
+	if len(contour) == 0 {
+		contour = append(contour, start)
+	}
+	return contour
+}
+
+func directionIndex(d image.Point) int {
+	for i, n := range mooreNeighborhood {
+		if n == d {
+			return i
+		}
+	}
+	return 0
+}
+
+func perpendicularDistance(p image.Point, a image.Point, b image.Point) float64 {
+	dx := float64(b.X - a.X)
+	dy := float64(b.Y - a.Y)
+	if dx == 0 && dy == 0 {
+		return math.Hypot(float64(p.X-a.X), float64(p.Y-a.Y))
+	}
+	return math.Abs(dy*float64(p.X)-dx*float64(p.Y)+float64(b.X*a.Y)-float64(b.Y*a.X)) / math.Hypot(dx, dy)
+}
+
+//simplifyContour reduces the number of points with the Ramer-Douglas-Peucker algorithm
+func simplifyContour(points []image.Point, epsilon float64) []image.Point {
+	if len(points) < 3 {
+		return points
+	}
+
+	maxDistance := 0.0
+	index := 0
+	for i := 1; i < len(points)-1; i++ {
+		distance := perpendicularDistance(points[i], points[0], points[len(points)-1])
+		if distance > maxDistance {
+			maxDistance = distance
+			index = i
+		}
+	}
+
+	if maxDistance <= epsilon {
+		return []image.Point{points[0], points[len(points)-1]}
+	}
+
+	left := simplifyContour(points[:index+1], epsilon)
+	right := simplifyContour(points[index:], epsilon)
+	return append(left[:len(left)-1], right...)
+}
+
+//simplifiedContour traces the boundary of the region and simplifies it
+func simplifiedContour(mask *binaryMask, region int, start image.Point) []image.Point {
+	contour := traceContour(mask, region, start)
+	//close the contour for the simplification, so that the end point can be removed as well
+	contour = simplifyContour(append(contour, contour[0]), contourSimplifyEpsilon)
+	return contour[:len(contour)-1]
+}
+
+//bridgeHole cuts the hole into the outer contour. Both are connected at their closest
+//points, the polygon runs around the hole and back to the outer contour along the
+//same line. The hole has to run in the opposite direction of the outer contour.
+func bridgeHole(outer []image.Point, hole []image.Point) []image.Point {
+	bestOuter, bestHole, bestDistance := 0, 0, math.MaxInt
+	for i, p := range outer {
+		for j, q := range hole {
+			d := p.Sub(q)
+			if distance := d.X*d.X + d.Y*d.Y; distance < bestDistance {
+				bestOuter, bestHole, bestDistance = i, j, distance
+			}
+		}
+	}
+
+	points := make([]image.Point, 0, len(outer)+len(hole)+2)
+	points = append(points, outer[:bestOuter+1]...)
+	points = append(points, hole[bestHole:]...)
+	points = append(points, hole[:bestHole+1]...)
+	return append(points, outer[bestOuter:]...)
+}
+
+//firstPixels returns the first pixel in raster order of every region of the mask
+func firstPixels(mask *binaryMask) map[int]image.Point {
+	starts := make(map[int]image.Point)
+	for i, region := range mask.regions {
+		if region == 0 {
+			continue
+		}
+		if _, ok := starts[region]; !ok {
+			starts[region] = image.Point{X: i % mask.width, Y: i / mask.width}
+		}
+	}
+	return starts
+}
+
+//MaskToPolygons converts a mask image into one polygon per region (largest region
+//first). Holes in a region (e.g. of a ring) are cut into its polygon, as the
+//ImageMonkey polygons can't have holes. The points are translated by offset, as
+//LabelMe masks usually only cover the bounding box of the object.
+func MaskToPolygons(img image.Image, offset image.Point) []Polygon {
+	mask, sizes := labelRegions(img)
+	starts := firstPixels(mask)
+
+	var regions []int
+	for region := 1; region < len(sizes); region++ {
+		if sizes[region] >= minMaskRegionSize {
+			regions = append(regions, region)
+		}
+	}
+	sort.SliceStable(regions, func(i, j int) bool {
+		return sizes[regions[i]] > sizes[regions[j]]
+	})
+
+	holes, holeSizes, enclosing := labelHoles(mask)
+	holeStarts := firstPixels(holes)
+	regionHoles := make(map[int][]int)
+	for hole := 1; hole < len(holeSizes); hole++ {
+		if holeSizes[hole] >= minMaskRegionSize {
+			regionHoles[enclosing[hole]] = append(regionHoles[enclosing[hole]], hole)
+		}
+	}
+
+	var polygons []Polygon
+	for _, region := range regions {
+		contour := simplifiedContour(mask, region, starts[region])
+		if len(contour) < 3 {
+			continue
+		}
+		for _, hole := range regionHoles[region] {
+			holeContour := simplifiedContour(holes, hole, holeStarts[hole])
+			if len(holeContour) < 3 {
+				continue
+			}
+			//the hole is traced in the same direction as the region
+			for i, j := 0, len(holeContour)-1; i < j; i, j = i+1, j-1 {
+				holeContour[i], holeContour[j] = holeContour[j], holeContour[i]
+			}
+			contour = bridgeHole(contour, holeContour)
+		}
+
+		var polygon Polygon
+		for _, point := range contour {
+			polygon.Points = append(polygon.Points, Point{X: int32(point.X + offset.X), Y: int32(point.Y + offset.Y)})
+		}
+		polygons = append(polygons, polygon)
+	}
+
+	return polygons
+}
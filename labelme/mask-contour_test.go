@@ -0,0 +1,122 @@
+package labelme
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+//newMask paints the rectangles white and clears the holes again. The rectangles are
+//given as x0, y0, x1, y1 (inclusive).
+func newMask(width int, height int, rects [][4]int, holes [][4]int) *image.Gray {
+	mask := image.NewGray(image.Rect(0, 0, width, height))
+	paint := func(r [4]int, value uint8) {
+		for y := r[1]; y <= r[3]; y++ {
+			for x := r[0]; x <= r[2]; x++ {
+				mask.SetGray(x, y, color.Gray{Y: value})
+			}
+		}
+	}
+	for _, r := range rects {
+		paint(r, 255)
+	}
+	for _, r := range holes {
+		paint(r, 0)
+	}
+	return mask
+}
+
+func TestMaskToPolygons(t *testing.T) {
+	tests := []struct {
+		name string
+		rects [][4]int
+		holes [][4]int
+		offset image.Point
+		//area of every polygon (the contours run through the centers of the border pixels)
+		areas []float64
+	}{
+		{
+			name: "square",
+			rects: [][4]int{{5, 5, 14, 14}},
+			areas: []float64{81},
+		},
+		{
+			name: "square at the border",
+			rects: [][4]int{{0, 0, 9, 9}},
+			areas: []float64{81},
+		},
+		{
+			name: "two regions, largest first",
+			rects: [][4]int{{2, 2, 6, 6}, {10, 10, 19, 19}},
+			areas: []float64{81, 16},
+		},
+		{
+			name: "noise is dropped",
+			rects: [][4]int{{2, 2, 3, 3}, {10, 10, 19, 19}},
+			areas: []float64{81},
+		},
+		{
+			name: "ring",
+			rects: [][4]int{{2, 2, 21, 21}},
+			holes: [][4]int{{8, 8, 15, 15}},
+			//outer 19x19 minus the hole 7x7
+			areas: []float64{361 - 49},
+		},
+		{
+			name: "two holes",
+			rects: [][4]int{{2, 2, 29, 17}},
+			holes: [][4]int{{5, 5, 10, 10}, {18, 5, 25, 12}},
+			areas: []float64{27*15 - 5*5 - 7*7},
+		},
+		{
+			name: "small holes are ignored",
+			rects: [][4]int{{2, 2, 21, 21}},
+			holes: [][4]int{{8, 8, 9, 9}},
+			areas: []float64{361},
+		},
+		{
+			name: "offset",
+			rects: [][4]int{{5, 5, 14, 14}},
+			offset: image.Point{X: 100, Y: 50},
+			areas: []float64{81},
+		},
+	}
+
+	for _, test := range tests {
+		mask := newMask(32, 24, test.rects, test.holes)
+		polygons := MaskToPolygons(mask, test.offset)
+		if len(polygons) != len(test.areas) {
+			t.Errorf("%s: got %d polygons, want %d", test.name, len(polygons), len(test.areas))
+			continue
+		}
+
+		for i, polygon := range polygons {
+			area := Object{MaskPolygons: []Polygon{polygon}}.Area()
+			if math.Abs(area-test.areas[i]) > 0.5 {
+				t.Errorf("%s: polygon %d has area %.1f, want %.1f", test.name, i, area, test.areas[i])
+			}
+
+			//the points of the holes are the border pixels of the holes, so the points
+			//are only checked against the rectangles
+			for _, point := range polygon.Points {
+				x, y := int(point.X)-test.offset.X, int(point.Y)-test.offset.Y
+				inside := false
+				for _, r := range test.rects {
+					inside = inside || (x >= r[0] && x <= r[2] && y >= r[1] && y <= r[3])
+				}
+				if !inside {
+					t.Errorf("%s: point (%d, %d) of polygon %d is outside of the mask", test.name, point.X, point.Y, i)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestMaskToPolygonsEmpty(t *testing.T) {
+	polygons := MaskToPolygons(newMask(16, 16, nil, nil), image.Point{})
+	if len(polygons) != 0 {
+		t.Errorf("got %d polygons of an empty mask, want none", len(polygons))
+	}
+}
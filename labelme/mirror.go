@@ -0,0 +1,574 @@
+package labelme
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const DefaultMirrorConcurrency = 8
+
+var hrefRegex = regexp.MustCompile(`(?i)href\s*=\s*"([^"]+)"`)
+var tagRegex = regexp.MustCompile(`<[^>]*>`)
+//modification time and size of a file in an Apache directory listing, e.g.
+//"2009-03-05 12:34  1.2K" or "05-Mar-2009 12:34  1234"
+var listingRegex = regexp.MustCompile(`(\d{4}-\d{2}-\d{2}|\d{2}-[A-Za-z]{3}-\d{4})\s+(\d{2}:\d{2}(?::\d{2})?)\s+(\d+(?:\.\d+)?[KMGT]?)\b`)
+
+type MirrorError struct {
+	Url string
+	Err error
+}
+
+func (e MirrorError) Error() string {
+	return e.Url + ": " + e.Err.Error()
+}
+
+type MirrorResult struct {
+	Added []string
+	Changed []string
+	Removed []string
+	Unchanged int
+	Skipped int
+	Failed []MirrorError
+}
+
+//Mirror mirrors a directory tree of the LabelMe website (the equivalent of
+//wget -m -np) into targetDirectory. The metadata of the downloaded files is
+//recorded in the manifest, which is used to detect changes on the next sync.
+type Mirror struct {
+	baseUrl string
+	targetDirectory string
+	manifest *Manifest
+	concurrency int
+	client *http.Client
+}
+
+func NewMirror(baseUrl string, targetDirectory string, manifest *Manifest, concurrency int) *Mirror {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Mirror{
+		baseUrl: baseUrl,
+		targetDirectory: targetDirectory,
+		manifest: manifest,
+		concurrency: concurrency,
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (p *Mirror) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New("unexpected status " + resp.Status)
+	}
+
+	return resp, nil
+}
+
+//remoteFile is a file linked in a directory listing. Listing is the modification time
+//and size the listing shows next to the link (empty if it doesn't show them).
+type remoteFile struct {
+	Url string
+	Listing ManifestEntry
+}
+
+//parseListingSize parses the size column of a directory listing (e.g. "1234" or "1.2K")
+func parseListingSize(s string) int64 {
+	multiplier := 1.0
+	switch s[len(s)-1] {
+	case 'K':
+		multiplier = 1 << 10
+	case 'M':
+		multiplier = 1 << 20
+	case 'G':
+		multiplier = 1 << 30
+	case 'T':
+		multiplier = 1 << 40
+	}
+	f, err := strconv.ParseFloat(strings.TrimRight(s, "KMGT"), 64)
+	if err != nil {
+		return 0
+	}
+	return int64(f * multiplier)
+}
+
+//parseListing returns the modification time and size of the listing text that
+//follows a link. The values are kept as shown, they are only compared with the
+//values of earlier listings.
+func parseListing(text []byte) ManifestEntry {
+	text = tagRegex.ReplaceAll(text, []byte(" "))
+	matches := listingRegex.FindAllSubmatch(text, -1)
+	if len(matches) == 0 {
+		return ManifestEntry{}
+	}
+	//the name of the file comes first, so the last match is the one of the columns
+	match := matches[len(matches)-1]
+	return ManifestEntry{
+		LastModified: string(match[1]) + " " + string(match[2]),
+		Size: parseListingSize(string(match[3])),
+	}
+}
+
+//parseIndex returns the absolute urls of the sub directories and files that are
+//linked in the directory listing of dirUrl. Links that point outside of dirUrl
+//(parent directory, sort links, absolute links) are ignored.
+func parseIndex(dirUrl *url.URL, body []byte) ([]string, []remoteFile) {
+	var dirs []string
+	var files []remoteFile
+
+	seen := map[string]bool{}
+	matches := hrefRegex.FindAllSubmatchIndex(body, -1)
+	for i, match := range matches {
+		href := string(body[match[2]:match[3]])
+		if strings.HasPrefix(href, "?") || strings.HasPrefix(href, "#") {
+			continue
+		}
+
+		ref, err := url.Parse(href)
+		if err != nil {
+			continue
+		}
+
+		u := dirUrl.ResolveReference(ref)
+		u.RawQuery = ""
+		u.Fragment = ""
+		if u.Host != dirUrl.Host || !strings.HasPrefix(u.Path, dirUrl.Path) || u.Path == dirUrl.Path {
+			continue
+		}
+
+		s := u.String()
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+
+		if strings.HasSuffix(u.Path, "/") {
+			dirs = append(dirs, s)
+			continue
+		}
+
+		//the columns of the file are between its link and the next one
+		end := len(body)
+		if i + 1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		files = append(files, remoteFile{Url: s, Listing: parseListing(body[match[1]:end])})
+	}
+
+	return dirs, files
+}
+
+//crawl walks the directory listings starting at rootUrl and returns all files
+func (p *Mirror) crawl(ctx context.Context, rootUrl string) ([]remoteFile, []MirrorError) {
+	var files []remoteFile
+	var failed []MirrorError
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	semaphore := make(chan struct{}, p.concurrency)
+
+	var listDir func(dirUrl string)
+	listDir = func(dirUrl string) {
+		defer wg.Done()
+
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		dirs, dirFiles, err := p.listDir(ctx, dirUrl)
+		<-semaphore
+
+		mutex.Lock()
+		if err != nil {
+			failed = append(failed, MirrorError{Url: dirUrl, Err: err})
+		}
+		files = append(files, dirFiles...)
+		mutex.Unlock()
+
+		for _, dir := range dirs {
+			wg.Add(1)
+			go listDir(dir)
+		}
+	}
+
+	wg.Add(1)
+	go listDir(rootUrl)
+	wg.Wait()
+
+	return files, failed
+}
+
+func (p *Mirror) listDir(ctx context.Context, dirUrl string) ([]string, []remoteFile, error) {
+	u, err := url.Parse(dirUrl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := p.get(ctx, dirUrl)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dirs, files := parseIndex(u, body)
+	return dirs, files, nil
+}
+
+//relativeName returns the path of the file relative to the base url
+func (p *Mirror) relativeName(fileUrl string) (string, error) {
+	u, err := url.Parse(fileUrl)
+	if err != nil {
+		return "", err
+	}
+	base, err := url.Parse(p.baseUrl)
+	if err != nil {
+		return "", err
+	}
+
+	name, err := url.PathUnescape(strings.TrimPrefix(u.EscapedPath(), base.EscapedPath()))
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(name, "..") {
+		return "", errors.New("invalid path " + name)
+	}
+
+	return name, nil
+}
+
+//localPath returns the path the file with the given relative name is stored at
+func (p *Mirror) localPath(name string) string {
+	return filepath.Join(p.targetDirectory, filepath.FromSlash(name))
+}
+
+//writeTempFile writes the body to a temporary file next to path, so that an
+//interrupted download never leaves a truncated file behind that would be
+//skipped on resume
+func writeTempFile(path string, body io.Reader) (string, int64, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return "", 0, err
+	}
+
+	tmpPath := path + ".part"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	size, err := io.Copy(file, body)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", 0, err
+	}
+
+	return tmpPath, size, nil
+}
+
+func sameContent(path1 string, path2 string) (bool, error) {
+	content1, err := ioutil.ReadFile(path1)
+	if err != nil {
+		return false, err
+	}
+	content2, err := ioutil.ReadFile(path2)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(content1, content2), nil
+}
+
+type fileStatus int
+
+const (
+	fileSkipped fileStatus = iota
+	fileUnchanged
+	fileAdded
+	fileChanged
+)
+
+//syncFile downloads a single file. Files that exist locally are skipped, unless
+//incremental is set. In that case the file is skipped if the listing shows the same
+//modification time and size as when it was downloaded. Otherwise it is requested
+//conditionally (based on the ETag/Last-Modified stored in the manifest) and only
+//replaced if it changed.
+func (p *Mirror) syncFile(ctx context.Context, file remoteFile, incremental bool) (fileStatus, error) {
+	fileUrl := file.Url
+	name, err := p.relativeName(fileUrl)
+	if err != nil {
+		return fileSkipped, err
+	}
+
+	path := p.localPath(name)
+	_, err = os.Stat(path)
+	exists := (err == nil)
+	if exists && !incremental {
+		return fileSkipped, nil
+	}
+
+	entry, hasEntry := p.manifest.Get(name)
+	if exists && hasEntry && entry.Listing != nil && entry.Listing.Matches(file.Listing) {
+		return fileUnchanged, nil
+	}
+	var listing *ManifestEntry
+	if file.Listing.LastModified != "" {
+		listing = &file.Listing
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fileUrl, nil)
+	if err != nil {
+		return fileSkipped, err
+	}
+	if hasEntry && exists {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fileSkipped, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && exists {
+		entry.Listing = listing
+		p.manifest.Set(name, entry)
+		return fileUnchanged, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fileSkipped, errors.New("unexpected status " + resp.Status)
+	}
+
+	tmpPath, size, err := writeTempFile(path, resp.Body)
+	if err != nil {
+		return fileSkipped, err
+	}
+
+	newEntry := manifestEntryFromResponse(resp, size)
+	newEntry.Listing = listing
+
+	status := fileAdded
+	if exists {
+		//the server doesn't necessarily support conditional requests, so compare the content
+		same, err := sameContent(tmpPath, path)
+		if err != nil {
+			os.Remove(tmpPath)
+			return fileSkipped, err
+		}
+
+		if same {
+			os.Remove(tmpPath)
+			p.manifest.Set(name, newEntry)
+			return fileUnchanged, nil
+		}
+		status = fileChanged
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fileSkipped, err
+	}
+	p.manifest.Set(name, newEntry)
+
+	return status, nil
+}
+
+//Mirror mirrors the directory dir (relative to the base url, e.g. "Annotations/").
+//Files that already exist locally are skipped.
+func (p *Mirror) Mirror(dir string) (MirrorResult, error) {
+	return p.MirrorContext(context.Background(), dir)
+}
+
+//MirrorContext is Mirror with a context. When the context is cancelled, the files
+//downloaded so far are kept (and recorded in the manifest), so the next call resumes.
+func (p *Mirror) MirrorContext(ctx context.Context, dir string) (MirrorResult, error) {
+	return p.run(ctx, dir, false)
+}
+
+//Sync compares the directory dir with the local mirror and downloads new and
+//changed files. Files that no longer exist remotely are removed.
+func (p *Mirror) Sync(dir string) (MirrorResult, error) {
+	return p.SyncContext(context.Background(), dir)
+}
+
+//SyncContext is Sync with a context. A cancelled sync doesn't remove any files.
+func (p *Mirror) SyncContext(ctx context.Context, dir string) (MirrorResult, error) {
+	return p.run(ctx, dir, true)
+}
+
+//localNames returns the names of the files in the local mirror of dir
+func (p *Mirror) localNames(dir string) ([]string, error) {
+	var names []string
+	root := p.localPath(dir)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(p.targetDirectory, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(name))
+		return nil
+	})
+	return names, err
+}
+
+func (p *Mirror) run(ctx context.Context, dir string, incremental bool) (MirrorResult, error) {
+	var result MirrorResult
+
+	fmt.Printf("crawling %s%s\n", p.baseUrl, dir)
+	files, failed := p.crawl(ctx, p.baseUrl + dir)
+	result.Failed = failed
+	fmt.Printf("found %d files\n", len(files))
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var done int32
+
+	jobs := make(chan remoteFile)
+	for i := 0; i < p.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				fileUrl := file.Url
+				status, err := p.syncFile(ctx, file, incremental)
+				//downloads aborted by the context aren't failures, they are resumed next time
+				if err != nil && ctx.Err() != nil {
+					continue
+				}
+				n := atomic.AddInt32(&done, 1)
+
+				mutex.Lock()
+				if err != nil {
+					result.Failed = append(result.Failed, MirrorError{Url: fileUrl, Err: err})
+					fmt.Printf("[%d/%d] Couldn't download %s: %s\n", n, len(files), fileUrl, err.Error())
+				} else {
+					switch status {
+					case fileSkipped:
+						result.Skipped++
+					case fileUnchanged:
+						result.Unchanged++
+					case fileAdded:
+						result.Added = append(result.Added, fileUrl)
+						fmt.Printf("[%d/%d] Downloaded %s\n", n, len(files), fileUrl)
+					case fileChanged:
+						result.Changed = append(result.Changed, fileUrl)
+						fmt.Printf("[%d/%d] Updated %s\n", n, len(files), fileUrl)
+					}
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, file := range files {
+		select {
+		case jobs <- file:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	//only remove files if the listing is complete, otherwise we might remove
+	//files just because a directory listing couldn't be fetched
+	if incremental && len(failed) == 0 && ctx.Err() == nil {
+		remoteFiles := make(map[string]bool)
+		for _, file := range files {
+			if name, err := p.relativeName(file.Url); err == nil {
+				remoteFiles[name] = true
+			}
+		}
+
+		//files that were never recorded in the manifest (e.g. copied into the mirror
+		//by hand) are removed as well
+		names, err := p.localNames(dir)
+		if err != nil {
+			result.Failed = append(result.Failed, MirrorError{Url: p.baseUrl + dir, Err: err})
+		}
+		names = append(names, p.manifest.Names(dir)...)
+		sort.Strings(names)
+
+		for i, name := range names {
+			if remoteFiles[name] || (i > 0 && names[i-1] == name) {
+				continue
+			}
+
+			err := os.Remove(p.localPath(name))
+			if err != nil && !os.IsNotExist(err) {
+				result.Failed = append(result.Failed, MirrorError{Url: p.baseUrl + name, Err: err})
+				continue
+			}
+			p.manifest.Delete(name)
+			result.Removed = append(result.Removed, p.baseUrl + name)
+			fmt.Printf("Removed %s\n", p.baseUrl + name)
+		}
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Changed)
+	sort.Strings(result.Removed)
+
+	err := p.manifest.Persist()
+	if err != nil {
+		return result, err
+	}
+
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+
+	if len(result.Failed) > 0 {
+		return result, fmt.Errorf("mirroring %s failed for %d urls (first error: %s)", dir, len(result.Failed), result.Failed[0].Error())
+	}
+
+	return result, nil
+}
@@ -0,0 +1,213 @@
+package labelme
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseIndex(t *testing.T) {
+	dirUrl, err := url.Parse("http://labelme.invalid/Annotations/folder/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		dirs []string
+		files []remoteFile
+	}{
+		{
+			name: "pre listing",
+			body: `<pre><a href="?C=N;O=D">Name</a> <a href="?C=M;O=A">Last modified</a>
+<a href="/Annotations/">Parent Directory</a>                             -
+<a href="sub/">sub/</a>                    2009-03-05 12:34    -
+<a href="img1.xml">img1.xml</a>            2009-03-05 12:34  1.2K
+<a href="img%202.xml">img 2.xml</a>        05-Mar-2010 08:00  734
+</pre>`,
+			dirs: []string{"http://labelme.invalid/Annotations/folder/sub/"},
+			files: []remoteFile{
+				{Url: "http://labelme.invalid/Annotations/folder/img1.xml", Listing: ManifestEntry{LastModified: "2009-03-05 12:34", Size: 1228}},
+				{Url: "http://labelme.invalid/Annotations/folder/img%202.xml", Listing: ManifestEntry{LastModified: "05-Mar-2010 08:00", Size: 734}},
+			},
+		},
+		{
+			name: "table listing",
+			body: `<table><tr><td><a href="img1.xml">img1.xml</a></td><td align="right">2009-03-05 12:34:56  </td><td align="right">512</td></tr>
+<tr><td><a href="img2.xml">img2.xml</a></td><td align="right">2009-03-06 01:02  </td><td align="right">2M</td></tr></table>`,
+			files: []remoteFile{
+				{Url: "http://labelme.invalid/Annotations/folder/img1.xml", Listing: ManifestEntry{LastModified: "2009-03-05 12:34:56", Size: 512}},
+				{Url: "http://labelme.invalid/Annotations/folder/img2.xml", Listing: ManifestEntry{LastModified: "2009-03-06 01:02", Size: 2 << 20}},
+			},
+		},
+		{
+			name: "links only",
+			body: `<a href="img1.xml">img1.xml</a> <a href="http://other.invalid/img2.xml">img2.xml</a>`,
+			files: []remoteFile{
+				{Url: "http://labelme.invalid/Annotations/folder/img1.xml"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		dirs, files := parseIndex(dirUrl, []byte(test.body))
+		if !reflect.DeepEqual(dirs, test.dirs) {
+			t.Errorf("%s: got dirs %v, want %v", test.name, dirs, test.dirs)
+		}
+		if !reflect.DeepEqual(files, test.files) {
+			t.Errorf("%s: got files %+v, want %+v", test.name, files, test.files)
+		}
+	}
+}
+
+//fakeLabelMe serves the files as Apache directory listings. It ignores conditional
+//requests and counts the downloads of every file.
+type fakeLabelMe struct {
+	mutex sync.Mutex
+	//the content and the modification time shown in the listing of every file
+	files map[string][2]string
+	downloads map[string]int
+}
+
+func (f *fakeLabelMe) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if file, ok := f.files[name]; ok {
+		f.downloads[name]++
+		fmt.Fprint(w, file[0])
+		return
+	}
+	if !strings.HasSuffix(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	dirs := map[string]bool{}
+	var names []string
+	for fileName := range f.files {
+		if strings.HasPrefix(fileName, name) {
+			names = append(names, fileName)
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Fprint(w, "<pre>\n")
+	for _, fileName := range names {
+		rest := strings.TrimPrefix(fileName, name)
+		if i := strings.Index(rest, "/"); i >= 0 {
+			if !dirs[rest[:i]] {
+				dirs[rest[:i]] = true
+				fmt.Fprintf(w, "<a href=\"%s/\">%s/</a>  2009-01-01 00:00  -\n", rest[:i], rest[:i])
+			}
+			continue
+		}
+		file := f.files[fileName]
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>  %s  %d\n", rest, rest, file[1], len(file[0]))
+	}
+	fmt.Fprint(w, "</pre>\n")
+}
+
+func (f *fakeLabelMe) set(name string, content string, modified string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if content == "" {
+		delete(f.files, name)
+		return
+	}
+	f.files[name] = [2]string{content, modified}
+}
+
+//takeDownloads returns the sorted names of the downloaded files and resets the counts
+func (f *fakeLabelMe) takeDownloads() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var names []string
+	for name := range f.downloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	f.downloads = map[string]int{}
+	return names
+}
+
+func TestMirrorSync(t *testing.T) {
+	labelMe := &fakeLabelMe{
+		files: map[string][2]string{
+			"Annotations/a/1.xml": {"<annotation>1</annotation>", "2009-03-05 12:34"},
+			"Annotations/a/2.xml": {"<annotation>2</annotation>", "2009-03-05 12:34"},
+			"Annotations/b/3.xml": {"<annotation>3</annotation>", "2009-03-05 12:34"},
+		},
+		downloads: map[string]int{},
+	}
+	server := httptest.NewServer(labelMe)
+	defer server.Close()
+
+	dir := t.TempDir()
+	manifest, err := readManifest(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror := NewMirror(server.URL + "/", filepath.Join(dir, "mirror"), manifest, 2)
+	sync := func() MirrorResult {
+		result, err := mirror.SyncContext(context.Background(), "Annotations/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := sync()
+	if len(result.Added) != 3 {
+		t.Errorf("first sync added %v, want 3 files", result.Added)
+	}
+	labelMe.takeDownloads()
+
+	//the listing didn't change, nothing is downloaded
+	result = sync()
+	if downloads := labelMe.takeDownloads(); len(downloads) != 0 || result.Unchanged != 3 {
+		t.Errorf("unchanged sync downloaded %v (%d unchanged), want no downloads", downloads, result.Unchanged)
+	}
+
+	labelMe.set("Annotations/a/2.xml", "<annotation>2, changed</annotation>", "2009-03-06 08:00")
+	labelMe.set("Annotations/b/4.xml", "<annotation>4</annotation>", "2009-03-06 08:00")
+	labelMe.set("Annotations/a/1.xml", "", "")
+	stray := filepath.Join(dir, "mirror", "Annotations", "b", "stray.xml")
+	err = ioutil.WriteFile(stray, []byte("<annotation/>"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result = sync()
+	if downloads := labelMe.takeDownloads(); !reflect.DeepEqual(downloads, []string{"Annotations/a/2.xml", "Annotations/b/4.xml"}) {
+		t.Errorf("sync downloaded %v, want only the changed and the new file", downloads)
+	}
+	if len(result.Changed) != 1 || len(result.Added) != 1 {
+		t.Errorf("sync changed %v and added %v, want one each", result.Changed, result.Added)
+	}
+	want := []string{server.URL + "/Annotations/a/1.xml", server.URL + "/Annotations/b/stray.xml"}
+	if !reflect.DeepEqual(result.Removed, want) {
+		t.Errorf("sync removed %v, want %v", result.Removed, want)
+	}
+	for _, path := range []string{stray, filepath.Join(dir, "mirror", "Annotations", "a", "1.xml")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s wasn't removed", path)
+		}
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "mirror", "Annotations", "a", "2.xml"))
+	if err != nil || string(content) != "<annotation>2, changed</annotation>" {
+		t.Errorf("got content %q (%v) of the changed file", content, err)
+	}
+}
@@ -0,0 +1,458 @@
+package labelme
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//ObjectFilter is a compiled filter expression, e.g.
+//	name ~ "^car" and !occluded and area > 500
+//
+//String fields (name, label, attributes, username) support the operators
+//	=  exact match         !=  no exact match
+//	~  regular expression  like  glob pattern (case-insensitive)
+//	is  same label after normalization and mapping
+//label is the ImageMonkey label the name is mapped to.
+//Number fields (area, points) support = != < <= > >=.
+//Boolean fields (occluded, deleted, verified) are used on their own.
+//Expressions can be combined with and, or, not/! and parentheses.
+type ObjectFilter struct {
+	expr string
+	root filterNode
+	geometry bool
+}
+
+func (f *ObjectFilter) String() string {
+	return f.expr
+}
+
+//UsesGeometry returns true if the filter compares the area or the points of the
+//objects. These depend on the polygons, so they have to be evaluated after the
+//masks of the objects were traced.
+func (f *ObjectFilter) UsesGeometry() bool {
+	return f != nil && f.geometry
+}
+
+//Match returns true if the object matches the filter. A nil filter matches everything.
+func (f *ObjectFilter) Match(object Object) bool {
+	if f == nil {
+		return true
+	}
+	return f.root.match(object)
+}
+
+//FilterObjects removes all objects that don't match the filter
+func (a *Annotation) FilterObjects(filter *ObjectFilter) {
+	objects := make([]Object, 0, len(a.Objects))
+	for _, object := range a.Objects {
+		if filter.Match(object) {
+			objects = append(objects, object)
+		}
+	}
+	a.Objects = objects
+}
+
+//HasMatchingObject returns true if at least one object matches the filter
+func (a Annotation) HasMatchingObject(filter *ObjectFilter) bool {
+	for _, object := range a.Objects {
+		if filter.Match(object) {
+			return true
+		}
+	}
+	return false
+}
+
+//Area returns the area of all polygons of the object (shoelace formula)
+func (o Object) Area() float64 {
+	area := 0.0
+	for _, polygon := range o.Polygons() {
+		sum := 0.0
+		n := len(polygon.Points)
+		for i := 0; i < n; i++ {
+			p1 := polygon.Points[i]
+			p2 := polygon.Points[(i+1)%n]
+			sum += float64(p1.X)*float64(p2.Y) - float64(p2.X)*float64(p1.Y)
+		}
+		area += math.Abs(sum) / 2
+	}
+	return area
+}
+
+//NumPoints returns the number of points of all polygons of the object
+func (o Object) NumPoints() int {
+	num := 0
+	for _, polygon := range o.Polygons() {
+		num += len(polygon.Points)
+	}
+	return num
+}
+
+type filterNode interface {
+	match(object Object) bool
+}
+
+type andNode struct {
+	left, right filterNode
+}
+
+func (n andNode) match(object Object) bool {
+	return n.left.match(object) && n.right.match(object)
+}
+
+type orNode struct {
+	left, right filterNode
+}
+
+func (n orNode) match(object Object) bool {
+	return n.left.match(object) || n.right.match(object)
+}
+
+type notNode struct {
+	node filterNode
+}
+
+func (n notNode) match(object Object) bool {
+	return !n.node.match(object)
+}
+
+type boolNode struct {
+	get func(Object) bool
+}
+
+func (n boolNode) match(object Object) bool {
+	return n.get(object)
+}
+
+type stringNode struct {
+	get func(Object) string
+	test func(string) bool
+}
+
+func (n stringNode) match(object Object) bool {
+	return n.test(n.get(object))
+}
+
+type numberNode struct {
+	get func(Object) float64
+	op string
+	value float64
+}
+
+func (n numberNode) match(object Object) bool {
+	v := n.get(object)
+	switch n.op {
+	case "=":
+		return v == n.value
+	case "!=":
+		return v != n.value
+	case "<":
+		return v < n.value
+	case "<=":
+		return v <= n.value
+	case ">":
+		return v > n.value
+	case ">=":
+		return v >= n.value
+	}
+	return false
+}
+
+var stringFields = map[string]func(Object) string{
+	"name": func(o Object) string { return strings.TrimSpace(o.Name) },
+	"attributes": func(o Object) string { return strings.TrimSpace(o.Attributes) },
+	"username": func(o Object) string { return o.GetUsername() },
+}
+
+var numberFields = map[string]func(Object) float64{
+	"area": func(o Object) float64 { return o.Area() },
+	"points": func(o Object) float64 { return float64(o.NumPoints()) },
+}
+
+var boolFields = map[string]func(Object) bool{
+	"occluded": func(o Object) bool { return o.IsOccluded() },
+	"deleted": func(o Object) bool { return o.IsDeleted() },
+	"verified": func(o Object) bool { return o.IsVerified() },
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos int
+}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(expr) {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			s, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %s", i, err.Error())
+			}
+			tokens = append(tokens, token{kind: tokenString, text: s, pos: i})
+			i = end + 1
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(expr) && (unicode.IsDigit(rune(expr[i])) || expr[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: expr[start:i], pos: start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(expr) && (unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i])) || expr[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: strings.ToLower(expr[start:i]), pos: start})
+		default:
+			op := ""
+			for _, candidate := range []string{"!=", "<=", ">=", "=", "~", "<", ">", "!", "(", ")"} {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(expr)})
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []token
+	pos int
+	mapper *LabelMapper
+	geometry bool
+}
+
+func (p *filterParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && t.text == keyword
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	t := p.peek()
+	if (t.kind == tokenOp && t.text == "!") || p.isKeyword("not") {
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	t := p.next()
+	if t.kind == tokenOp && t.text == "(" {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing := p.next()
+		if closing.kind != tokenOp || closing.text != ")" {
+			return nil, fmt.Errorf("expected ) at position %d", closing.pos)
+		}
+		return node, nil
+	}
+
+	if t.kind != tokenIdent {
+		return nil, fmt.Errorf("expected a field at position %d", t.pos)
+	}
+
+	if get, ok := boolFields[t.text]; ok {
+		return boolNode{get: get}, nil
+	}
+	if get, ok := stringFields[t.text]; ok {
+		return p.parseStringComparison(t, get)
+	}
+	if t.text == "label" {
+		mapper := p.mapper
+		return p.parseStringComparison(t, func(o Object) string { return mapper.MapLabel(o.Name) })
+	}
+	if get, ok := numberFields[t.text]; ok {
+		p.geometry = true
+		return p.parseNumberComparison(t, get)
+	}
+	return nil, fmt.Errorf("unknown field %s at position %d", t.text, t.pos)
+}
+
+func (p *filterParser) parseStringComparison(field token, get func(Object) string) (filterNode, error) {
+	op := p.next()
+	if op.kind != tokenOp && op.kind != tokenIdent {
+		return nil, fmt.Errorf("expected an operator after %s at position %d", field.text, op.pos)
+	}
+	value := p.next()
+	if value.kind != tokenString {
+		return nil, fmt.Errorf("expected a string after %s %s at position %d", field.text, op.text, value.pos)
+	}
+
+	s := value.text
+	switch op.text {
+	case "=":
+		return stringNode{get: get, test: func(v string) bool { return v == s }}, nil
+	case "!=":
+		return stringNode{get: get, test: func(v string) bool { return v != s }}, nil
+	case "~":
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %s", s, err.Error())
+		}
+		return stringNode{get: get, test: re.MatchString}, nil
+	case "like":
+		pattern := strings.ToLower(s)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", s, err.Error())
+		}
+		return stringNode{get: get, test: func(v string) bool {
+			matched, _ := path.Match(pattern, strings.ToLower(v))
+			return matched
+		}}, nil
+	case "is":
+		mapper := p.mapper
+		return stringNode{get: get, test: func(v string) bool { return mapper.Is(v, s) }}, nil
+	}
+	return nil, fmt.Errorf("invalid operator %s for %s at position %d", op.text, field.text, op.pos)
+}
+
+func (p *filterParser) parseNumberComparison(field token, get func(Object) float64) (filterNode, error) {
+	op := p.next()
+	if op.kind != tokenOp {
+		return nil, fmt.Errorf("expected an operator after %s at position %d", field.text, op.pos)
+	}
+	switch op.text {
+	case "=", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("invalid operator %s for %s at position %d", op.text, field.text, op.pos)
+	}
+
+	value := p.next()
+	if value.kind != tokenNumber {
+		return nil, fmt.Errorf("expected a number after %s %s at position %d", field.text, op.text, value.pos)
+	}
+	f, err := strconv.ParseFloat(value.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %s at position %d", value.text, value.pos)
+	}
+
+	return numberNode{get: get, op: op.text, value: f}, nil
+}
+
+//ParseObjectFilter compiles a filter expression. mapper may be nil, the default
+//normalization is used then.
+func ParseObjectFilter(expr string, mapper *LabelMapper) (*ObjectFilter, error) {
+	if mapper == nil {
+		mapper = DefaultLabelMapper()
+	}
+
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 {
+		return nil, errors.New("empty filter expression")
+	}
+
+	parser := &filterParser{tokens: tokens, mapper: mapper}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := parser.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+
+	return &ObjectFilter{expr: expr, root: root, geometry: parser.geometry}, nil
+}
+
+//NewLabelFilter returns a filter that matches the objects that are mapped to the
+//given ImageMonkey label and, if where isn't empty, the where expression. The label
+//is normalized like the names of the objects, so "Cars" matches "car" as well.
+func NewLabelFilter(label string, where string, mapper *LabelMapper) (*ObjectFilter, error) {
+	if where == "" {
+		return ParseObjectFilter("name is "+strconv.Quote(label), mapper)
+	}
+	if label == "" {
+		return ParseObjectFilter(where, mapper)
+	}
+	return ParseObjectFilter("name is "+strconv.Quote(label)+" and ("+where+")", mapper)
+}
@@ -0,0 +1,178 @@
+package labelme
+
+import (
+	"strings"
+	"testing"
+)
+
+//square returns a polygon with the given side length
+func square(side int32) Polygon {
+	return Polygon{Points: []Point{{X: 0, Y: 0}, {X: side, Y: 0}, {X: side, Y: side}, {X: 0, Y: side}}}
+}
+
+func TestObjectFilterMatch(t *testing.T) {
+	car := Object{Name: "Cars occluded", Occluded: "yes", Verified: 1, Attributes: "side, red", Polygon: square(10)}
+	car.Polygon.Username = "anonymous"
+	person := Object{Name: "person", Occluded: "no", Deleted: 1, Polygon: square(30)}
+	brush := Object{Name: "car", Segment: Segment{Mask: "mask.png", Username: "painter"}}
+
+	tests := []struct {
+		expr string
+		object Object
+		want bool
+	}{
+		{`name = "Cars occluded"`, car, true},
+		{`name = "car"`, car, false},
+		{`name != "car"`, car, true},
+		{`name ~ "^Car"`, car, true},
+		{`name ~ "^car"`, car, false},
+		{`name like "CAR*"`, car, true},
+		{`name like "c?r"`, brush, true},
+		{`name is "car"`, car, true},
+		{`name is "Car"`, car, true},
+		{`name is "person"`, car, false},
+		{`label = "car"`, car, true},
+		{`label = "Car"`, car, false},
+		{`label is "Car"`, car, true},
+		{`attributes ~ "red"`, car, true},
+		{`not attributes ~ "red"`, car, false},
+		{`username = "anonymous"`, car, true},
+		{`username = "painter"`, brush, true},
+		{`username = "anonymous"`, brush, false},
+		{`username ~ "^$"`, person, true},
+		{`occluded`, car, true},
+		{`!occluded`, person, true},
+		{`deleted`, person, true},
+		{`verified`, person, false},
+		{`area = 100`, car, true},
+		{`area > 500`, car, false},
+		{`area > 500`, person, true},
+		{`area >= 100 and area <= 100`, car, true},
+		{`area < 0.5`, brush, true},
+		{`points = 4`, car, true},
+		{`points != 4`, car, false},
+		{`points = 0`, brush, true},
+		{`occluded and area > 500`, car, false},
+		{`occluded or area > 500`, person, true},
+		{`not (occluded or area > 500)`, brush, true},
+		{`name = "person" or name = "car" and occluded`, brush, false},
+		{`(name = "person" or name = "car") and !occluded`, brush, true},
+		{`LABEL IS "car" AND NOT DELETED`, car, true},
+	}
+
+	for _, test := range tests {
+		filter, err := ParseObjectFilter(test.expr, nil)
+		if err != nil {
+			t.Errorf("ParseObjectFilter(%q) failed: %s", test.expr, err.Error())
+			continue
+		}
+		if got := filter.Match(test.object); got != test.want {
+			t.Errorf("%q on %q = %v, want %v", test.expr, test.object.Name, got, test.want)
+		}
+	}
+}
+
+func TestParseObjectFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		//part of the error message
+		err string
+	}{
+		{``, "empty filter expression"},
+		{`   `, "empty filter expression"},
+		{`name ~ "("`, "invalid regular expression"},
+		{`name ~ "[a-"`, "invalid regular expression"},
+		{`attributes ~ "*"`, "invalid regular expression"},
+		{`name like "[a-"`, "invalid pattern"},
+		{`name = "car`, "unterminated string"},
+		{`name = car`, "expected a string after name ="},
+		{`name > "car"`, "invalid operator > for name"},
+		{`area ~ "1"`, "invalid operator ~ for area"},
+		{`area > "1"`, "expected a number after area >"},
+		{`area > 1.2.3`, "invalid number"},
+		{`color = "red"`, "unknown field color"},
+		{`name = "car" and`, "expected a field"},
+		{`(name = "car"`, "expected )"},
+		{`name = "car")`, "unexpected \")\""},
+		{`occluded occluded`, "unexpected \"occluded\""},
+		{`name = "car" & occluded`, "unexpected character '&'"},
+		{`name`, "expected an operator after name"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseObjectFilter(test.expr, nil)
+		if err == nil {
+			t.Errorf("ParseObjectFilter(%q) didn't fail, want %q", test.expr, test.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("ParseObjectFilter(%q) failed with %q, want %q", test.expr, err.Error(), test.err)
+		}
+	}
+}
+
+func TestObjectFilterUsesGeometry(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`name = "car"`, false},
+		{`occluded and label is "car"`, false},
+		{`area > 500`, true},
+		{`name = "car" and points < 10`, true},
+		{`not (occluded or area > 5)`, true},
+	}
+
+	for _, test := range tests {
+		filter, err := ParseObjectFilter(test.expr, nil)
+		if err != nil {
+			t.Errorf("ParseObjectFilter(%q) failed: %s", test.expr, err.Error())
+			continue
+		}
+		if got := filter.UsesGeometry(); got != test.want {
+			t.Errorf("UsesGeometry(%q) = %v, want %v", test.expr, got, test.want)
+		}
+	}
+
+	var filter *ObjectFilter
+	if filter.UsesGeometry() {
+		t.Errorf("UsesGeometry of the nil filter = true, want false")
+	}
+}
+
+func TestNewLabelFilter(t *testing.T) {
+	mapper := NewLabelMapper(LabelMappingFile{
+		Labels: map[string][]string{"car": {"carside"}},
+	})
+
+	tests := []struct {
+		label string
+		where string
+		name string
+		occluded string
+		want bool
+	}{
+		{"car", "", "car", "no", true},
+		{"Car", "", "car", "no", true},
+		{"Cars", "", "carside", "no", true},
+		{"car", "", "bus", "no", false},
+		{"glasses", "", "glasses", "no", true},
+		{"glasses", "", "glass", "no", false},
+		{"car", "!occluded", "cars", "no", true},
+		{"car", "!occluded", "cars", "yes", false},
+		{"car", `name = "bus" or !occluded`, "bus", "no", false},
+		{"", "occluded", "bus", "yes", true},
+	}
+
+	for _, test := range tests {
+		filter, err := NewLabelFilter(test.label, test.where, mapper)
+		if err != nil {
+			t.Errorf("NewLabelFilter(%q, %q) failed: %s", test.label, test.where, err.Error())
+			continue
+		}
+		object := Object{Name: test.name, Occluded: test.occluded}
+		if got := filter.Match(object); got != test.want {
+			t.Errorf("NewLabelFilter(%q, %q) on %q = %v, want %v", test.label, test.where, test.name, got, test.want)
+		}
+	}
+}
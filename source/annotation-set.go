@@ -0,0 +1,117 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+)
+
+//annotationSet keeps all annotations of a dataset in memory. It implements the
+//listing and annotation methods of Source for the sources that read their
+//annotations completely when they are loaded.
+type annotationSet struct {
+	labelMapper *labelme.LabelMapper
+	annotations map[string]labelme.Annotation
+	imageInfos []labelme.ImageInfo
+}
+
+func newAnnotationSet(labelMapper *labelme.LabelMapper) annotationSet {
+	if labelMapper == nil {
+		labelMapper = labelme.DefaultLabelMapper()
+	}
+	return annotationSet{labelMapper: labelMapper, annotations: make(map[string]labelme.Annotation)}
+}
+
+//add adds the annotation of the image, it returns false if the image already has one
+func (p *annotationSet) add(imageInfo labelme.ImageInfo, annotation labelme.Annotation) bool {
+	if _, exists := p.annotations[imageInfo.UniqueName]; exists {
+		return false
+	}
+	p.annotations[imageInfo.UniqueName] = annotation
+	p.imageInfos = append(p.imageInfos, imageInfo)
+	return true
+}
+
+//sort brings the images into a stable order, after they were added in parallel
+func (p *annotationSet) sort() {
+	sort.Slice(p.imageInfos, func(i, j int) bool {
+		return p.imageInfos[i].UniqueName < p.imageInfos[j].UniqueName
+	})
+}
+
+func (p *annotationSet) GetLabelMapper() *labelme.LabelMapper {
+	return p.labelMapper
+}
+
+//Labels returns the number of objects per name
+func (p *annotationSet) Labels(ctx context.Context, filter *labelme.ObjectFilter) (map[string]int32, error) {
+	labelMap := make(map[string]int32)
+	for _, annotation := range p.annotations {
+		for _, object := range annotation.Objects {
+			if filter.Match(object) {
+				labelMap[object.Name] += 1
+			}
+		}
+	}
+	return labelMap, ctx.Err()
+}
+
+func (p *annotationSet) collectImageInfos(match func(labelme.Annotation) bool) []labelme.ImageInfo {
+	var imageInfos []labelme.ImageInfo
+	for _, imageInfo := range p.imageInfos {
+		if match(p.annotations[imageInfo.UniqueName]) {
+			imageInfos = append(imageInfos, imageInfo)
+		}
+	}
+	return imageInfos
+}
+
+func (p *annotationSet) GetImageInfos(label string) ([]labelme.ImageInfo, error) {
+	return p.collectImageInfos(func(annotation labelme.Annotation) bool {
+		for _, object := range annotation.Objects {
+			if p.labelMapper.Is(object.Name, label) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (p *annotationSet) FindImageInfos(filter *labelme.ObjectFilter) []labelme.ImageInfo {
+	return p.collectImageInfos(func(annotation labelme.Annotation) bool {
+		return annotation.HasMatchingObject(filter)
+	})
+}
+
+func (p *annotationSet) GetAnnotationContext(ctx context.Context, imageInfo labelme.ImageInfo, filter *labelme.ObjectFilter) (labelme.Annotation, error) {
+	if err := ctx.Err(); err != nil {
+		return labelme.Annotation{}, err
+	}
+	annotation, ok := p.annotations[imageInfo.UniqueName]
+	if !ok {
+		return annotation, fmt.Errorf("there is no annotation of %s", imageInfo.UniqueName)
+	}
+	//FilterObjects creates a new slice, the stored annotation stays intact
+	annotation.FilterObjects(filter)
+	return annotation, nil
+}
+
+//roundPoint rounds the coordinate and keeps it within the image
+func roundPoint(x float64, y float64, width int32, height int32) labelme.Point {
+	point := labelme.Point{X: int32(math.Round(x)), Y: int32(math.Round(y))}
+	if point.X >= width {
+		point.X = width - 1
+	}
+	if point.Y >= height {
+		point.Y = height - 1
+	}
+	if point.X < 0 {
+		point.X = 0
+	}
+	if point.Y < 0 {
+		point.Y = 0
+	}
+	return point
+}
@@ -0,0 +1,405 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+)
+
+var _ Source = (*COCODataset)(nil)
+var _ MaskResolver = (*COCODataset)(nil)
+
+func init() {
+	Register("coco", func(options Options) (Source, error) {
+		return NewCOCODataset(options), nil
+	})
+}
+
+type cocoImage struct {
+	Id int64 `json:"id"`
+	FileName string `json:"file_name"`
+	Width int32 `json:"width"`
+	Height int32 `json:"height"`
+	CocoUrl string `json:"coco_url"`
+	FlickrUrl string `json:"flickr_url"`
+}
+
+type cocoCategory struct {
+	Id int64 `json:"id"`
+	Name string `json:"name"`
+	Supercategory string `json:"supercategory"`
+}
+
+type cocoAnnotation struct {
+	Id int64 `json:"id"`
+	ImageId int64 `json:"image_id"`
+	CategoryId int64 `json:"category_id"`
+	//either a list of polygons [[x1, y1, x2, y2, ...], ...] or a run-length encoded mask
+	Segmentation json.RawMessage `json:"segmentation"`
+	//[x, y, width, height]
+	Bbox []float64 `json:"bbox"`
+	IsCrowd int `json:"iscrowd"`
+}
+
+//cocoRLE is a run-length encoded mask. The runs alternate between background and
+//foreground (starting with background) and go through the mask column by column.
+//Counts is either a list of numbers or a string in the compressed COCO format.
+type cocoRLE struct {
+	Counts json.RawMessage `json:"counts"`
+	//[height, width]
+	Size []int `json:"size"`
+}
+
+type cocoFile struct {
+	Images []cocoImage `json:"images"`
+	Annotations []cocoAnnotation `json:"annotations"`
+	Categories []cocoCategory `json:"categories"`
+}
+
+//COCODataset is a dataset in the COCO format: annotations/instances_<split>.json
+//and, optionally, the images in <split>/. Images that aren't stored locally are
+//downloaded from their coco_url. Polygon segmentations are used as they are,
+//run-length encoded masks are traced into polygons when the annotation is pushed.
+type COCODataset struct {
+	annotationSet
+	baseDirectory string
+	objectOptions labelme.ObjectOptions
+	downloadOptions labelme.DownloadOptions
+	httpClient *http.Client
+
+	urls map[string]string
+	//run-length encoded masks by cocoRLEKey
+	rles map[string]cocoRLE
+}
+
+func NewCOCODataset(options Options) *COCODataset {
+	p := &COCODataset{
+		annotationSet: newAnnotationSet(options.LabelMapper),
+		baseDirectory: options.Directory,
+		objectOptions: options.ObjectOptions,
+		downloadOptions: options.DownloadOptions,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+	if p.downloadOptions == (labelme.DownloadOptions{}) {
+		p.downloadOptions = labelme.DefaultDownloadOptions()
+	}
+	return p
+}
+
+func (p *COCODataset) Name() string {
+	return "coco"
+}
+
+func (p *COCODataset) GetCacheDirectory() string {
+	return p.baseDirectory + "/cache/"
+}
+
+//cocoSplit returns the name of the split of an instances file, e.g. val2017
+func cocoSplit(path string) string {
+	return strings.TrimPrefix(strings.TrimSuffix(filepath.Base(path), ".json"), "instances_")
+}
+
+//cocoRLEKey identifies the mask of an object. The ids of the annotations are only
+//unique within an instances file, so the split is part of the key.
+func cocoRLEKey(split string, objectId string) string {
+	return split + "/" + objectId
+}
+
+//toObject converts the COCO annotation into a LabelMe object. Run-length encoded
+//masks are stored in rles and resolved by ResolveMasksContext.
+func (a cocoAnnotation) toObject(name string, split string, img cocoImage, rles map[string]cocoRLE) (labelme.Object, error) {
+	object := labelme.Object{
+		Id: strconv.FormatInt(a.Id, 10),
+		Name: name,
+		//COCO annotations are checked by several workers, there are no unverified ones
+		Verified: 1,
+		Occluded: "no",
+	}
+	if a.IsCrowd == 1 {
+		object.Attributes = "crowd"
+	}
+
+	segmentation := strings.TrimSpace(string(a.Segmentation))
+	switch {
+	case strings.HasPrefix(segmentation, "["):
+		var polygons [][]float64
+		err := json.Unmarshal(a.Segmentation, &polygons)
+		if err != nil {
+			return object, err
+		}
+		for _, coordinates := range polygons {
+			var polygon labelme.Polygon
+			for i := 0; i + 1 < len(coordinates); i += 2 {
+				polygon.Points = append(polygon.Points, roundPoint(coordinates[i], coordinates[i + 1], img.Width, img.Height))
+			}
+			object.MaskPolygons = append(object.MaskPolygons, polygon)
+		}
+		//a single polygon is the common case, it's used like a polygon drawn in LabelMe
+		if len(object.MaskPolygons) == 1 {
+			object.Polygon = object.MaskPolygons[0]
+			object.MaskPolygons = nil
+		}
+	case strings.HasPrefix(segmentation, "{"):
+		var rle cocoRLE
+		err := json.Unmarshal(a.Segmentation, &rle)
+		if err != nil {
+			return object, err
+		}
+		rles[cocoRLEKey(split, object.Id)] = rle
+	}
+
+	//detection datasets only have bounding boxes
+	if len(object.Polygon.Points) == 0 && len(object.MaskPolygons) == 0 && len(a.Bbox) == 4 && !strings.HasPrefix(segmentation, "{") {
+		x, y, w, h := a.Bbox[0], a.Bbox[1], a.Bbox[2], a.Bbox[3]
+		object.Polygon.Points = []labelme.Point{
+			roundPoint(x, y, img.Width, img.Height),
+			roundPoint(x + w, y, img.Width, img.Height),
+			roundPoint(x + w, y + h, img.Width, img.Height),
+			roundPoint(x, y + h, img.Width, img.Height),
+		}
+	}
+
+	return object, nil
+}
+
+func readCOCOFile(path string) (cocoFile, error) {
+	var file cocoFile
+	f, err := os.Open(path)
+	if err != nil {
+		return file, err
+	}
+	defer f.Close()
+
+	err = json.NewDecoder(f).Decode(&file)
+	return file, err
+}
+
+//LoadContext reads all instances files of the dataset. The annotations are kept in memory.
+func (p *COCODataset) LoadContext(ctx context.Context) error {
+	paths, err := filepath.Glob(filepath.Join(p.baseDirectory, "annotations", "instances_*.json"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("%s doesn't look like a COCO dataset: there are no annotations/instances_*.json files", p.baseDirectory)
+	}
+
+	set := newAnnotationSet(p.labelMapper)
+	urls := make(map[string]string)
+	rles := make(map[string]cocoRLE)
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fmt.Printf("reading %s\n", path)
+		file, err := readCOCOFile(path)
+		if err != nil {
+			return fmt.Errorf("couldn't read %s: %s", path, err.Error())
+		}
+		split := cocoSplit(path)
+
+		categories := make(map[int64]string)
+		for _, category := range file.Categories {
+			categories[category.Id] = strings.TrimSpace(category.Name)
+		}
+
+		images := make(map[int64]cocoImage)
+		annotations := make(map[int64]*labelme.Annotation)
+		for _, img := range file.Images {
+			images[img.Id] = img
+			annotations[img.Id] = &labelme.Annotation{
+				Folder: split,
+				Filename: img.FileName,
+				ImageSize: labelme.ImageSize{NRows: img.Height, NCols: img.Width},
+			}
+		}
+
+		skipped := 0
+		for _, elem := range file.Annotations {
+			annotation, ok := annotations[elem.ImageId]
+			name, known := categories[elem.CategoryId]
+			if !ok || !known {
+				skipped++
+				continue
+			}
+			object, err := elem.toObject(name, split, images[elem.ImageId], rles)
+			if err != nil {
+				fmt.Printf("Couldn't convert annotation %d: %s\n", elem.Id, err.Error())
+				skipped++
+				continue
+			}
+			if p.objectOptions.Keep(object) {
+				annotation.Objects = append(annotation.Objects, object)
+			}
+		}
+		if skipped > 0 {
+			fmt.Printf("skipped %d annotations of %s\n", skipped, path)
+		}
+
+		for _, img := range file.Images {
+			imageInfo := labelme.ImageInfo{Folder: split, Filename: img.FileName, UniqueName: split + "_" + img.FileName}
+			if !set.add(imageInfo, *annotations[img.Id]) {
+				fmt.Printf("Skipping image %d of %s: there is already an image %s\n", img.Id, path, imageInfo.UniqueName)
+				continue
+			}
+			if img.CocoUrl != "" {
+				urls[imageInfo.UniqueName] = img.CocoUrl
+			} else if img.FlickrUrl != "" {
+				urls[imageInfo.UniqueName] = img.FlickrUrl
+			}
+		}
+	}
+
+	set.sort()
+	p.annotationSet = set
+	p.urls = urls
+	p.rles = rles
+	return nil
+}
+
+//decodeCounts returns the runs of the mask, decoding the compressed format of the
+//COCO API (a LEB128 like encoding with 6 bit chunks, the runs after the second one
+//are stored as difference to the run two positions before)
+func (p cocoRLE) decodeCounts() ([]int, error) {
+	var counts []int
+	if err := json.Unmarshal(p.Counts, &counts); err == nil {
+		return counts, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(p.Counts, &s); err != nil {
+		return nil, errors.New("counts is neither a list nor a string")
+	}
+	for i := 0; i < len(s); {
+		x, k := 0, 0
+		more := true
+		for more {
+			if i >= len(s) {
+				return nil, errors.New("truncated counts")
+			}
+			c := int(s[i]) - 48
+			x |= (c & 0x1f) << (5 * k)
+			more = c & 0x20 != 0
+			i++
+			k++
+			if !more && c & 0x10 != 0 {
+				x |= -1 << (5 * k)
+			}
+		}
+		if len(counts) > 2 {
+			x += counts[len(counts) - 2]
+		}
+		counts = append(counts, x)
+	}
+	return counts, nil
+}
+
+//toMask paints the foreground of the mask white
+func (p cocoRLE) toMask() (image.Image, error) {
+	if len(p.Size) != 2 {
+		return nil, errors.New("invalid size of the mask")
+	}
+	height, width := p.Size[0], p.Size[1]
+
+	counts, err := p.decodeCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	mask := image.NewGray(image.Rect(0, 0, width, height))
+	pos := 0
+	for i, count := range counts {
+		if i % 2 == 1 {
+			for j := pos; j < pos + count && j < width * height; j++ {
+				mask.SetGray(j / height, j % height, color.Gray{Y: 255})
+			}
+		}
+		pos += count
+	}
+	return mask, nil
+}
+
+//ResolveMasksContext traces the run-length encoded masks (which are used for
+//crowds) of the objects into polygons
+func (p *COCODataset) ResolveMasksContext(ctx context.Context, annotation *labelme.Annotation) error {
+	for i := range annotation.Objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		object := &annotation.Objects[i]
+		rle, ok := p.rles[cocoRLEKey(annotation.Folder, object.Id)]
+		if !ok || len(object.Polygons()) > 0 {
+			continue
+		}
+
+		mask, err := rle.toMask()
+		if err != nil {
+			return fmt.Errorf("couldn't decode mask of object %s: %s", object.Id, err.Error())
+		}
+		object.MaskPolygons = labelme.MaskToPolygons(mask, image.Point{})
+	}
+	return nil
+}
+
+//getLocalImagePath returns the path of the image in the directory of its split
+func (p *COCODataset) getLocalImagePath(imageInfo labelme.ImageInfo) string {
+	return filepath.Join(p.baseDirectory, imageInfo.Folder, imageInfo.Filename)
+}
+
+func (p *COCODataset) getImagePath(label string, imageInfo labelme.ImageInfo) string {
+	path := p.getLocalImagePath(imageInfo)
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	return p.GetCacheDirectory() + label + "/" + imageInfo.UniqueName
+}
+
+//DownloadImagesContext downloads the images that aren't stored locally from their
+//coco_url into the cache directory
+func (p *COCODataset) DownloadImagesContext(ctx context.Context, imageInfos []labelme.ImageInfo, label string) error {
+	dir := p.GetCacheDirectory() + label
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	var jobs []labelme.DownloadJob
+	for _, imageInfo := range imageInfos {
+		if _, err := os.Stat(p.getLocalImagePath(imageInfo)); err == nil {
+			continue
+		}
+		url, ok := p.urls[imageInfo.UniqueName]
+		if !ok {
+			return fmt.Errorf("image %s isn't stored in %s and has no url", imageInfo.UniqueName, filepath.Join(p.baseDirectory, imageInfo.Folder))
+		}
+		jobs = append(jobs, labelme.DownloadJob{Url: url, Path: dir + "/" + imageInfo.UniqueName, Name: imageInfo.UniqueName})
+	}
+	if len(jobs) < len(imageInfos) {
+		fmt.Printf("%d of %d images are stored locally\n", len(imageInfos) - len(jobs), len(imageInfos))
+	}
+
+	return labelme.DownloadJobs(ctx, p.httpClient, jobs, p.downloadOptions)
+}
+
+//GetImageContext opens the image, either from the directory of its split or from
+//the cache. The url of the image is its coco_url (or flickr_url), it stays empty if
+//the image has neither.
+func (p *COCODataset) GetImageContext(ctx context.Context, label string, imageInfo labelme.ImageInfo, scaled bool) (labelme.Image, error) {
+	im, err := labelme.OpenImageContext(ctx, p.getImagePath(label, imageInfo), scaled)
+	if err != nil {
+		return im, err
+	}
+	im.Url = p.urls[imageInfo.UniqueName]
+	return im, nil
+}
@@ -0,0 +1,248 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+)
+
+//encodeCounts compresses the runs like rleToString of the COCO API
+func encodeCounts(counts []int) string {
+	var s []byte
+	for i := range counts {
+		x := counts[i]
+		if i > 2 {
+			x -= counts[i-2]
+		}
+		more := true
+		for more {
+			c := x & 0x1f
+			x >>= 5
+			if c&0x10 != 0 {
+				more = x != -1
+			} else {
+				more = x != 0
+			}
+			if more {
+				c |= 0x20
+			}
+			s = append(s, byte(c+48))
+		}
+	}
+	return string(s)
+}
+
+//rectCounts returns the runs of a height x width mask with the rectangle x0..x1,
+//y0..y1 (inclusive) set
+func rectCounts(height int, width int, x0 int, y0 int, x1 int, y1 int) []int {
+	var counts []int
+	current, run := false, 0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			set := x >= x0 && x <= x1 && y >= y0 && y <= y1
+			if set != current {
+				counts = append(counts, run)
+				run = 0
+				current = set
+			}
+			run++
+		}
+	}
+	return append(counts, run)
+}
+
+func newRLE(t *testing.T, height int, width int, counts interface{}) cocoRLE {
+	raw, err := json.Marshal(counts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cocoRLE{Counts: raw, Size: []int{height, width}}
+}
+
+func TestCOCORLEDecodeCounts(t *testing.T) {
+	large := rectCounts(480, 640, 100, 50, 399, 299)
+
+	tests := []struct {
+		name string
+		counts interface{}
+		want []int
+		//part of the error message, empty if decoding has to succeed
+		err string
+	}{
+		{name: "uncompressed", counts: []int{3, 2, 5}, want: []int{3, 2, 5}},
+		{name: "compressed", counts: encodeCounts([]int{3, 2, 5}), want: []int{3, 2, 5}},
+		{name: "compressed with zero", counts: encodeCounts([]int{0, 4, 12}), want: []int{0, 4, 12}},
+		//runs after the second one are stored as difference, which can be negative
+		{name: "compressed differences", counts: encodeCounts([]int{100, 5, 20, 1, 300, 2}), want: []int{100, 5, 20, 1, 300, 2}},
+		{name: "compressed large", counts: encodeCounts(large), want: large},
+		{name: "empty", counts: "", want: nil},
+		{name: "truncated", counts: encodeCounts([]int{100000})[:2], err: "truncated counts"},
+		{name: "invalid", counts: map[string]int{"a": 1}, err: "counts is neither a list nor a string"},
+	}
+
+	for _, test := range tests {
+		got, err := newRLE(t, 1, 1, test.counts).decodeCounts()
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: decodeCounts failed: %s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCOCORLEToMask(t *testing.T) {
+	tests := []struct {
+		name string
+		rle func(t *testing.T) cocoRLE
+		//the rectangle x0, y0, x1, y1 that has to be set
+		rect [4]int
+		err string
+	}{
+		{
+			name: "uncompressed",
+			rle: func(t *testing.T) cocoRLE { return newRLE(t, 8, 10, rectCounts(8, 10, 2, 1, 5, 6)) },
+			rect: [4]int{2, 1, 5, 6},
+		},
+		{
+			name: "compressed",
+			rle: func(t *testing.T) cocoRLE { return newRLE(t, 8, 10, encodeCounts(rectCounts(8, 10, 0, 0, 9, 3))) },
+			rect: [4]int{0, 0, 9, 3},
+		},
+		{
+			//column major: 3 background pixels, then 2 foreground pixels in the first column
+			name: "column major",
+			rle: func(t *testing.T) cocoRLE { return newRLE(t, 5, 2, []int{3, 2, 5}) },
+			rect: [4]int{0, 3, 0, 4},
+		},
+		{
+			name: "runs longer than the mask",
+			rle: func(t *testing.T) cocoRLE { return newRLE(t, 4, 4, []int{12, 100}) },
+			rect: [4]int{3, 0, 3, 3},
+		},
+		{
+			name: "invalid size",
+			rle: func(t *testing.T) cocoRLE { return cocoRLE{Counts: json.RawMessage("[1]"), Size: []int{4}} },
+			err: "invalid size",
+		},
+	}
+
+	for _, test := range tests {
+		mask, err := test.rle(t).toMask()
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: toMask failed: %s", test.name, err.Error())
+			continue
+		}
+
+		bounds := mask.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, _, _, _ := mask.At(x, y).RGBA()
+				want := x >= test.rect[0] && x <= test.rect[2] && y >= test.rect[1] && y <= test.rect[3]
+				if (r > 0) != want {
+					t.Errorf("%s: pixel (%d, %d) is %v, want %v", test.name, x, y, r > 0, want)
+				}
+			}
+		}
+	}
+}
+
+//writeInstances writes an instances file with one image and one crowd annotation
+//with the given id, whose mask is the given rectangle
+func writeInstances(t *testing.T, dir string, split string, annotationId int, rect [4]int) {
+	const height, width = 40, 60
+	file := map[string]interface{}{
+		"images": []interface{}{
+			map[string]interface{}{"id": 1, "file_name": "000001.jpg", "width": width, "height": height},
+		},
+		"categories": []interface{}{
+			map[string]interface{}{"id": 1, "name": "person"},
+		},
+		"annotations": []interface{}{
+			map[string]interface{}{
+				"id": annotationId, "image_id": 1, "category_id": 1, "iscrowd": 1,
+				"segmentation": map[string]interface{}{
+					"size": []int{height, width},
+					"counts": encodeCounts(rectCounts(height, width, rect[0], rect[1], rect[2], rect[3])),
+				},
+			},
+		},
+	}
+	b, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "annotations", "instances_"+split+".json"), b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCOCOResolveMasksOfSplits(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "annotations"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the annotation ids are only unique within a split
+	rects := map[string][4]int{
+		"train2017": {5, 5, 24, 24},
+		"val2017": {30, 10, 49, 29},
+	}
+	for split, rect := range rects {
+		writeInstances(t, dir, split, 7, rect)
+	}
+
+	dataset := NewCOCODataset(Options{Directory: dir})
+	err = dataset.LoadContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for split, rect := range rects {
+		imageInfo := labelme.ImageInfo{Folder: split, Filename: "000001.jpg", UniqueName: split + "_000001.jpg"}
+		annotation, err := dataset.GetAnnotationContext(context.Background(), imageInfo, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = dataset.ResolveMasksContext(context.Background(), &annotation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(annotation.Objects) != 1 || len(annotation.Objects[0].MaskPolygons) != 1 {
+			t.Fatalf("%s: expected one object with one mask polygon, got %+v", split, annotation.Objects)
+		}
+
+		polygon := annotation.Objects[0].MaskPolygons[0]
+		bounds := image.Rectangle{Min: image.Point{X: 1 << 30, Y: 1 << 30}}
+		for _, point := range polygon.Points {
+			p := image.Point{X: int(point.X), Y: int(point.Y)}
+			bounds.Min = image.Point{X: min(bounds.Min.X, p.X), Y: min(bounds.Min.Y, p.Y)}
+			bounds.Max = image.Point{X: max(bounds.Max.X, p.X), Y: max(bounds.Max.Y, p.Y)}
+		}
+		want := image.Rect(rect[0], rect[1], rect[2], rect[3])
+		if bounds != want {
+			t.Errorf("%s: mask polygon covers %v, want %v", split, bounds, want)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	_"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+)
+
+var _ Source = (*LabelMeJSONDataset)(nil)
+
+func init() {
+	Register("labelme-json", func(options Options) (Source, error) {
+		return NewLabelMeJSONDataset(options), nil
+	})
+}
+
+//maximum distance (in pixels) between two points of an approximated circle
+const circleSegmentLength = 8
+
+type labelMeJSONShape struct {
+	Label string `json:"label"`
+	Points [][]float64 `json:"points"`
+	GroupId *int `json:"group_id"`
+	ShapeType string `json:"shape_type"`
+	Flags map[string]bool `json:"flags"`
+	//base64 encoded png of the mask of "mask" shapes, it covers the rectangle of the two points
+	Mask string `json:"mask"`
+}
+
+type labelMeJSONFile struct {
+	Shapes []labelMeJSONShape `json:"shapes"`
+	ImagePath string `json:"imagePath"`
+	ImageData string `json:"imageData"`
+	ImageHeight int32 `json:"imageHeight"`
+	ImageWidth int32 `json:"imageWidth"`
+}
+
+//LabelMeJSONDataset is a directory of the json files written by the labelme desktop
+//tool (https://github.com/wkentaro/labelme), one per image. The image is either
+//stored next to the json file (imagePath) or embedded into it (imageData).
+//Rectangles and circles are converted to polygons, shapes with the same group_id
+//and label become one object. Lines and points are skipped, as they can't be
+//converted into polygons.
+type LabelMeJSONDataset struct {
+	annotationSet
+	baseDirectory string
+	objectOptions labelme.ObjectOptions
+
+	paths map[string]string
+}
+
+func NewLabelMeJSONDataset(options Options) *LabelMeJSONDataset {
+	return &LabelMeJSONDataset{
+		annotationSet: newAnnotationSet(options.LabelMapper),
+		baseDirectory: options.Directory,
+		objectOptions: options.ObjectOptions,
+	}
+}
+
+func (p *LabelMeJSONDataset) Name() string {
+	return "labelme-json"
+}
+
+func (p *LabelMeJSONDataset) GetCacheDirectory() string {
+	return p.baseDirectory + "/cache/"
+}
+
+func jsonPoint(point []float64, width int32, height int32) labelme.Point {
+	if len(point) < 2 {
+		return labelme.Point{}
+	}
+	return roundPoint(point[0], point[1], width, height)
+}
+
+//circlePolygon approximates the circle around the center through the point on its edge
+func circlePolygon(center []float64, edge []float64, width int32, height int32) labelme.Polygon {
+	var polygon labelme.Polygon
+	if len(center) < 2 || len(edge) < 2 {
+		return polygon
+	}
+	radius := math.Hypot(edge[0] - center[0], edge[1] - center[1])
+	n := int(math.Ceil(2 * math.Pi * radius / circleSegmentLength))
+	if n < 8 {
+		n = 8
+	}
+	if n > 64 {
+		n = 64
+	}
+	for i := 0; i < n; i++ {
+		angle := 2 * math.Pi * float64(i) / float64(n)
+		polygon.Points = append(polygon.Points, roundPoint(center[0] + radius * math.Cos(angle), center[1] + radius * math.Sin(angle), width, height))
+	}
+	return polygon
+}
+
+//maskPolygons traces the mask of a "mask" shape, which covers the rectangle of its points
+func maskPolygons(shape labelMeJSONShape) ([]labelme.Polygon, error) {
+	if len(shape.Points) < 1 || len(shape.Points[0]) < 2 {
+		return nil, fmt.Errorf("mask without position")
+	}
+	data, err := base64.StdEncoding.DecodeString(shape.Mask)
+	if err != nil {
+		return nil, err
+	}
+	mask, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	offset := image.Point{X: int(math.Round(shape.Points[0][0])), Y: int(math.Round(shape.Points[0][1]))}
+	return labelme.MaskToPolygons(mask, offset), nil
+}
+
+//shapePolygons converts the shape into polygons. Shapes that aren't areas (lines
+//and points) return no polygons.
+func shapePolygons(shape labelMeJSONShape, width int32, height int32) ([]labelme.Polygon, error) {
+	var polygon labelme.Polygon
+	switch shape.ShapeType {
+	case "", "polygon":
+		for _, point := range shape.Points {
+			polygon.Points = append(polygon.Points, jsonPoint(point, width, height))
+		}
+	case "rectangle":
+		if len(shape.Points) != 2 || len(shape.Points[0]) < 2 || len(shape.Points[1]) < 2 {
+			return nil, fmt.Errorf("rectangle with %d points", len(shape.Points))
+		}
+		x0, x1 := math.Min(shape.Points[0][0], shape.Points[1][0]), math.Max(shape.Points[0][0], shape.Points[1][0])
+		y0, y1 := math.Min(shape.Points[0][1], shape.Points[1][1]), math.Max(shape.Points[0][1], shape.Points[1][1])
+		polygon.Points = []labelme.Point{
+			roundPoint(x0, y0, width, height),
+			roundPoint(x1, y0, width, height),
+			roundPoint(x1, y1, width, height),
+			roundPoint(x0, y1, width, height),
+		}
+	case "circle":
+		if len(shape.Points) != 2 {
+			return nil, fmt.Errorf("circle with %d points", len(shape.Points))
+		}
+		polygon = circlePolygon(shape.Points[0], shape.Points[1], width, height)
+	case "mask":
+		return maskPolygons(shape)
+	case "line", "linestrip", "point", "points":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown shape type %s", shape.ShapeType)
+	}
+	return []labelme.Polygon{polygon}, nil
+}
+
+//shapeFlags returns the flags of the shape that are set, sorted by name
+func shapeFlags(shape labelMeJSONShape) []string {
+	var flags []string
+	for flag, set := range shape.Flags {
+		if set {
+			flags = append(flags, flag)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+//toAnnotation converts the shapes into objects. The flags of the shapes become
+//attributes, the flags "verified" and "occluded" are used for the object as well.
+func (f labelMeJSONFile) toAnnotation(folder string, filename string) (labelme.Annotation, int, error) {
+	annotation := labelme.Annotation{
+		Folder: folder,
+		Filename: filename,
+		ImageSize: labelme.ImageSize{NRows: f.ImageHeight, NCols: f.ImageWidth},
+	}
+
+	width, height := f.ImageWidth, f.ImageHeight
+	if width <= 0 || height <= 0 {
+		width, height = math.MaxInt32, math.MaxInt32
+	}
+
+	skipped := 0
+	groups := make(map[string]int)
+	for i, shape := range f.Shapes {
+		polygons, err := shapePolygons(shape, width, height)
+		if err != nil {
+			return annotation, skipped, fmt.Errorf("shape %d: %s", i, err.Error())
+		}
+		if len(polygons) == 0 {
+			skipped++
+			continue
+		}
+
+		name := strings.TrimSpace(shape.Label)
+		//shapes of a group with the same label are parts of one object
+		key := ""
+		if shape.GroupId != nil {
+			key = name + "\x00" + strconv.Itoa(*shape.GroupId)
+			if j, ok := groups[key]; ok {
+				object := &annotation.Objects[j]
+				if len(object.Polygon.Points) > 0 {
+					object.MaskPolygons = append(object.MaskPolygons, object.Polygon)
+					object.Polygon = labelme.Polygon{}
+				}
+				object.MaskPolygons = append(object.MaskPolygons, polygons...)
+				continue
+			}
+		}
+
+		object := labelme.Object{
+			Id: strconv.Itoa(len(annotation.Objects)),
+			Name: name,
+			Occluded: "no",
+			Attributes: strings.Join(shapeFlags(shape), ", "),
+		}
+		if shape.Flags["verified"] {
+			object.Verified = 1
+		}
+		if shape.Flags["occluded"] {
+			object.Occluded = "yes"
+		}
+		if len(polygons) == 1 && shape.ShapeType != "mask" {
+			object.Polygon = polygons[0]
+		} else {
+			object.MaskPolygons = polygons
+		}
+
+		if key != "" {
+			groups[key] = len(annotation.Objects)
+		}
+		annotation.Objects = append(annotation.Objects, object)
+	}
+
+	return annotation, skipped, nil
+}
+
+func readLabelMeJSONFile(path string) (labelMeJSONFile, error) {
+	var file labelMeJSONFile
+	f, err := os.Open(path)
+	if err != nil {
+		return file, err
+	}
+	defer f.Close()
+
+	err = json.NewDecoder(f).Decode(&file)
+	return file, err
+}
+
+//LoadContext reads all json files below the dataset directory (except the cache).
+//Files that aren't labelme files are skipped.
+func (p *LabelMeJSONDataset) LoadContext(ctx context.Context) error {
+	if _, err := os.Stat(p.baseDirectory); err != nil {
+		return err
+	}
+
+	set := newAnnotationSet(p.labelMapper)
+	paths := make(map[string]string)
+	numSkippedFiles, numSkippedShapes := 0, 0
+	cacheDirectory := filepath.Clean(p.GetCacheDirectory())
+	err := filepath.Walk(p.baseDirectory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if filepath.Clean(path) == cacheDirectory {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+
+		file, err := readLabelMeJSONFile(path)
+		if err != nil || file.ImagePath == "" {
+			fmt.Printf("Skipping %s: not a labelme file\n", path)
+			numSkippedFiles++
+			return nil
+		}
+
+		folder, err := filepath.Rel(p.baseDirectory, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		folder = filepath.ToSlash(folder)
+		if folder == "." {
+			folder = ""
+		}
+		filename := filepath.Base(filepath.FromSlash(file.ImagePath))
+		//the json file belongs to exactly one image, so its name is unique
+		uniqueName := strings.ReplaceAll(strings.TrimSuffix(filepath.ToSlash(filepath.Join(folder, filepath.Base(path))), ".json"), "/", "_") + filepath.Ext(filename)
+
+		annotation, skipped, err := file.toAnnotation(folder, filename)
+		if err != nil {
+			fmt.Printf("Skipping %s: %s\n", path, err.Error())
+			numSkippedFiles++
+			return nil
+		}
+		numSkippedShapes += skipped
+
+		kept := make([]labelme.Object, 0, len(annotation.Objects))
+		for _, object := range annotation.Objects {
+			if p.objectOptions.Keep(object) {
+				kept = append(kept, object)
+			}
+		}
+		annotation.Objects = kept
+
+		set.add(labelme.ImageInfo{Folder: folder, Filename: filename, UniqueName: uniqueName}, annotation)
+		paths[uniqueName] = path
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if numSkippedFiles > 0 {
+		fmt.Printf("skipped %d json files\n", numSkippedFiles)
+	}
+	if numSkippedShapes > 0 {
+		fmt.Printf("skipped %d shapes without an area (lines and points)\n", numSkippedShapes)
+	}
+
+	set.sort()
+	p.annotationSet = set
+	p.paths = paths
+	return nil
+}
+
+//openImage opens the image referenced by the json file, or decodes the image
+//embedded into the json file if there is no such image
+func (p *LabelMeJSONDataset) openImage(ctx context.Context, imageInfo labelme.ImageInfo, scaled bool) (labelme.Image, error) {
+	path, ok := p.paths[imageInfo.UniqueName]
+	if !ok {
+		return labelme.Image{}, fmt.Errorf("there is no json file of %s", imageInfo.UniqueName)
+	}
+	file, err := readLabelMeJSONFile(path)
+	if err != nil {
+		return labelme.Image{}, err
+	}
+
+	imagePath := filepath.Join(filepath.Dir(path), filepath.FromSlash(file.ImagePath))
+	if _, err := os.Stat(imagePath); err == nil || file.ImageData == "" {
+		return labelme.OpenImageContext(ctx, imagePath, scaled)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(file.ImageData)
+	if err != nil {
+		return labelme.Image{}, fmt.Errorf("couldn't decode the image data of %s: %s", path, err.Error())
+	}
+	return labelme.DecodeImageContext(ctx, bytes.NewReader(data), scaled)
+}
+
+//DownloadImagesContext doesn't download anything, the images are stored next to
+//the json files or embedded into them. It only checks that all images can be opened.
+func (p *LabelMeJSONDataset) DownloadImagesContext(ctx context.Context, imageInfos []labelme.ImageInfo, label string) error {
+	missing := 0
+	for _, imageInfo := range imageInfos {
+		_, err := p.openImage(ctx, imageInfo, false)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Printf("Image %s is missing: %s\n", imageInfo.UniqueName, err.Error())
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d of %d images are missing", missing, len(imageInfos))
+	}
+	fmt.Printf("all %d images of %s are available\n", len(imageInfos), label)
+	return nil
+}
+
+//GetImageContext opens the image. The url of the image stays empty, as the images
+//don't have a public url.
+func (p *LabelMeJSONDataset) GetImageContext(ctx context.Context, label string, imageInfo labelme.ImageInfo, scaled bool) (labelme.Image, error) {
+	return p.openImage(ctx, imageInfo, scaled)
+}
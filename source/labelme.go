@@ -0,0 +1,34 @@
+package source
+
+import (
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+)
+
+var _ Source = (*labelme.Dataset)(nil)
+var _ MaskResolver = (*labelme.Dataset)(nil)
+var _ ImageExcluder = (*labelme.Dataset)(nil)
+
+func init() {
+	Register("labelme", openLabelMe)
+}
+
+//openLabelMe opens the LabelMe dataset, which is mirrored from the LabelMe website
+func openLabelMe(options Options) (Source, error) {
+	labelMeDataset := labelme.NewDataset(options.Directory, options.UseCache)
+	if options.MirrorConcurrency > 0 {
+		labelMeDataset.SetMirrorConcurrency(options.MirrorConcurrency)
+	}
+	if options.DownloadOptions != (labelme.DownloadOptions{}) {
+		labelMeDataset.SetDownloadOptions(options.DownloadOptions)
+	}
+	if options.ParseWorkers > 0 {
+		labelMeDataset.SetParseWorkers(options.ParseWorkers)
+	}
+	if options.ObjectOptions != (labelme.ObjectOptions{}) {
+		labelMeDataset.SetObjectOptions(options.ObjectOptions)
+	}
+	if options.LabelMapper != nil {
+		labelMeDataset.SetLabelMapper(options.LabelMapper)
+	}
+	return labelMeDataset, nil
+}
@@ -0,0 +1,114 @@
+//Package source abstracts the datasets images and annotations are taken from. The
+//LabelMe dataset is one source, others can be plugged in with Register so that they
+//can be downloaded and pushed to ImageMonkey the same way.
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+)
+
+//DefaultSource is the name of the source that is used when none is given
+const DefaultSource = "labelme"
+
+//Source is a dataset of images with annotations. The annotations of every source
+//are represented as LabelMe annotations (named objects with polygons), so that they
+//can be filtered, validated and converted to ImageMonkey annotations the same way.
+type Source interface {
+	//Name returns the name the source is registered with
+	Name() string
+	//LoadContext prepares the source, e.g. downloads or reads the annotations
+	LoadContext(ctx context.Context) error
+	//GetLabelMapper returns the mapping from the names of the source to ImageMonkey labels
+	GetLabelMapper() *labelme.LabelMapper
+	//Labels returns the number of objects per name of the source. With a filter,
+	//only the objects matching the filter are counted.
+	Labels(ctx context.Context, filter *labelme.ObjectFilter) (map[string]int32, error)
+	//GetImageInfos returns the images with objects that are mapped to the ImageMonkey label
+	GetImageInfos(label string) ([]labelme.ImageInfo, error)
+	//FindImageInfos returns the images with at least one object matching the filter
+	FindImageInfos(filter *labelme.ObjectFilter) []labelme.ImageInfo
+	//DownloadImagesContext makes the images available locally. Sources that
+	//already have their images on disk don't need to do anything.
+	DownloadImagesContext(ctx context.Context, imageInfos []labelme.ImageInfo, label string) error
+	//GetImageContext opens the image, scaled down for the donation if requested
+	GetImageContext(ctx context.Context, label string, imageInfo labelme.ImageInfo, scaled bool) (labelme.Image, error)
+	//GetAnnotationContext returns the annotation of the image with the objects matching the filter
+	GetAnnotationContext(ctx context.Context, imageInfo labelme.ImageInfo, filter *labelme.ObjectFilter) (labelme.Annotation, error)
+	//GetCacheDirectory returns the directory journals, reports and caches are stored in
+	GetCacheDirectory() string
+}
+
+//MaskResolver is implemented by sources whose annotations can refer to segmentation
+//masks that have to be loaded before the annotation is converted
+type MaskResolver interface {
+	ResolveMasksContext(ctx context.Context, annotation *labelme.Annotation) error
+}
+
+//ImageExcluder is implemented by sources that keep a list of images which must not be pushed
+type ImageExcluder interface {
+	GetImageException(imageInfo labelme.ImageInfo) (labelme.ImageException, bool)
+}
+
+//Options configures a source when it is opened. Zero values select the defaults of the source.
+type Options struct {
+	//Directory is the directory the dataset is stored in
+	Directory string
+	//UseCache enables the cache directory of the dataset
+	UseCache bool
+	//LabelMapper maps the names of the source to ImageMonkey labels
+	LabelMapper *labelme.LabelMapper
+	ObjectOptions labelme.ObjectOptions
+	ParseWorkers int
+	DownloadOptions labelme.DownloadOptions
+	MirrorConcurrency int
+}
+
+//Factory creates a source. It must not load the dataset yet, that's done by LoadContext.
+type Factory func(options Options) (Source, error)
+
+var factoriesMutex sync.RWMutex
+var factories = make(map[string]Factory)
+
+//Register makes a source available under the given name. It panics if the name is
+//registered twice, as that is a programming error.
+func Register(name string, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	if factory == nil {
+		panic("source: Register factory is nil")
+	}
+	if _, ok := factories[name]; ok {
+		panic("source: Register called twice for source " + name)
+	}
+	factories[name] = factory
+}
+
+//Names returns the sorted names of the registered sources
+func Names() []string {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//Open creates the source with the given name. The source still has to be loaded.
+func Open(name string, options Options) (Source, error) {
+	factoriesMutex.RLock()
+	factory, ok := factories[name]
+	factoriesMutex.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown source %s (available: %v)", name, Names())
+	}
+	return factory(options)
+}
@@ -0,0 +1,234 @@
+package source
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"github.com/ImageMonkey/imagemonkey-labelme-converter/labelme"
+)
+
+var _ Source = (*VOCDataset)(nil)
+
+func init() {
+	Register("voc", func(options Options) (Source, error) {
+		return NewVOCDataset(options), nil
+	})
+}
+
+type vocSize struct {
+	Width int32 `xml:"width"`
+	Height int32 `xml:"height"`
+}
+
+type vocBndBox struct {
+	Xmin float32 `xml:"xmin"`
+	Ymin float32 `xml:"ymin"`
+	Xmax float32 `xml:"xmax"`
+	Ymax float32 `xml:"ymax"`
+}
+
+type vocObject struct {
+	Name string `xml:"name"`
+	Pose string `xml:"pose"`
+	Truncated int `xml:"truncated"`
+	Difficult int `xml:"difficult"`
+	Occluded int `xml:"occluded"`
+	BndBox vocBndBox `xml:"bndbox"`
+}
+
+type vocAnnotation struct {
+	XMLName xml.Name `xml:"annotation"`
+	Folder string `xml:"folder"`
+	Filename string `xml:"filename"`
+	Size vocSize `xml:"size"`
+	Objects []vocObject `xml:"object"`
+}
+
+//VOCDataset is a dataset in the Pascal VOC format: one xml file per image in
+//Annotations/ and the images in JPEGImages/. The bounding boxes of the objects are
+//converted to rectangular polygons, the segmentation masks aren't used.
+type VOCDataset struct {
+	annotationSet
+	baseDirectory string
+	objectOptions labelme.ObjectOptions
+	parseWorkers int
+}
+
+func NewVOCDataset(options Options) *VOCDataset {
+	p := &VOCDataset{
+		annotationSet: newAnnotationSet(options.LabelMapper),
+		baseDirectory: options.Directory,
+		objectOptions: options.ObjectOptions,
+		parseWorkers: options.ParseWorkers,
+	}
+	if p.parseWorkers < 1 {
+		p.parseWorkers = labelme.DefaultParseWorkers()
+	}
+	return p
+}
+
+func (p *VOCDataset) Name() string {
+	return "voc"
+}
+
+func (p *VOCDataset) GetCacheDirectory() string {
+	return p.baseDirectory + "/cache/"
+}
+
+//vocAttributes describes the flags of the VOC object in the LabelMe attribute
+//syntax, so that they can be used in filters (e.g. not attributes ~ "difficult")
+func vocAttributes(object vocObject) string {
+	var attributes []string
+	if object.Truncated == 1 {
+		attributes = append(attributes, "truncated")
+	}
+	if object.Difficult == 1 {
+		attributes = append(attributes, "difficult")
+	}
+	if pose := strings.ToLower(strings.TrimSpace(object.Pose)); pose != "" && pose != "unspecified" {
+		attributes = append(attributes, pose)
+	}
+	return strings.Join(attributes, ", ")
+}
+
+//vocPoint converts a VOC coordinate (which is 1-based and sometimes written as
+//float) into the 0-based pixel coordinates of the LabelMe annotations. Some
+//annotations use 0 nevertheless, the points are kept within the image.
+func vocPoint(x float32, y float32, size vocSize) labelme.Point {
+	width, height := size.Width, size.Height
+	if width <= 0 || height <= 0 { //the size is optional, only keep the points positive then
+		width, height = math.MaxInt32, math.MaxInt32
+	}
+	return roundPoint(float64(x)-1, float64(y)-1, width, height)
+}
+
+//toAnnotation converts the VOC annotation into the LabelMe representation
+func (a vocAnnotation) toAnnotation(options labelme.ObjectOptions) labelme.Annotation {
+	annotation := labelme.Annotation{
+		Folder: strings.TrimSpace(a.Folder),
+		Filename: strings.TrimSpace(a.Filename),
+		ImageSize: labelme.ImageSize{NRows: a.Size.Height, NCols: a.Size.Width},
+	}
+
+	for i, elem := range a.Objects {
+		object := labelme.Object{
+			Id: strconv.Itoa(i),
+			Name: strings.TrimSpace(elem.Name),
+			//the VOC annotations are checked by the organizers of the challenge
+			Verified: 1,
+			Occluded: "no",
+			Attributes: vocAttributes(elem),
+			Polygon: labelme.Polygon{Points: []labelme.Point{
+				vocPoint(elem.BndBox.Xmin, elem.BndBox.Ymin, a.Size),
+				vocPoint(elem.BndBox.Xmax, elem.BndBox.Ymin, a.Size),
+				vocPoint(elem.BndBox.Xmax, elem.BndBox.Ymax, a.Size),
+				vocPoint(elem.BndBox.Xmin, elem.BndBox.Ymax, a.Size),
+			}},
+		}
+		if elem.Occluded == 1 {
+			object.Occluded = "yes"
+		}
+		if options.Keep(object) {
+			annotation.Objects = append(annotation.Objects, object)
+		}
+	}
+
+	return annotation
+}
+
+func parseVOCAnnotation(path string, options labelme.ObjectOptions) (labelme.Annotation, error) {
+	var annotation vocAnnotation
+	f, err := os.Open(path)
+	if err != nil {
+		return labelme.Annotation{}, err
+	}
+	defer f.Close()
+
+	err = xml.NewDecoder(f).Decode(&annotation)
+	if err != nil {
+		return labelme.Annotation{}, err
+	}
+	if strings.TrimSpace(annotation.Filename) == "" {
+		return labelme.Annotation{}, fmt.Errorf("annotation without filename")
+	}
+	return annotation.toAnnotation(options), nil
+}
+
+func vocImageInfo(annotation labelme.Annotation) labelme.ImageInfo {
+	imageInfo := labelme.ImageInfo{Folder: annotation.Folder, Filename: annotation.Filename, UniqueName: annotation.Filename}
+	if annotation.Folder != "" {
+		imageInfo.UniqueName = annotation.Folder + "_" + annotation.Filename
+	}
+	return imageInfo
+}
+
+//LoadContext parses all annotations of the dataset. The annotations are small, so
+//they are kept in memory.
+func (p *VOCDataset) LoadContext(ctx context.Context) error {
+	dir := p.baseDirectory + "/Annotations"
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("%s doesn't look like a VOC dataset: %s", p.baseDirectory, err.Error())
+	}
+
+	set := newAnnotationSet(p.labelMapper)
+	pipeline := labelme.NewAnnotationPipeline(dir, p.parseWorkers, func(path string) (labelme.Annotation, error) {
+		return parseVOCAnnotation(path, p.objectOptions)
+	})
+	for parsed := range pipeline.Results() {
+		if ctx.Err() != nil {
+			pipeline.Stop()
+			return ctx.Err()
+		}
+		imageInfo := vocImageInfo(parsed.Annotation)
+		if !set.add(imageInfo, parsed.Annotation) {
+			fmt.Printf("Skipping %s: there is already an annotation of %s\n", parsed.Path, imageInfo.UniqueName)
+		}
+	}
+
+	errs := pipeline.Errors()
+	for _, err := range errs {
+		fmt.Printf("Couldn't parse xml file %s\n", err.Error())
+	}
+	if len(errs) > 0 {
+		fmt.Printf("skipped %d xml files\n", len(errs))
+	}
+
+	set.sort()
+	p.annotationSet = set
+	return nil
+}
+
+func (p *VOCDataset) getImagePath(imageInfo labelme.ImageInfo) string {
+	return filepath.Join(p.baseDirectory, "JPEGImages", imageInfo.Filename)
+}
+
+//DownloadImagesContext doesn't download anything, the images of a VOC dataset are
+//stored locally. It only checks that all images exist.
+func (p *VOCDataset) DownloadImagesContext(ctx context.Context, imageInfos []labelme.ImageInfo, label string) error {
+	missing := 0
+	for _, imageInfo := range imageInfos {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := os.Stat(p.getImagePath(imageInfo)); err != nil {
+			fmt.Printf("Image %s is missing: %s\n", imageInfo.UniqueName, err.Error())
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d of %d images are missing in %s", missing, len(imageInfos), filepath.Join(p.baseDirectory, "JPEGImages"))
+	}
+	fmt.Printf("all %d images of %s are available\n", len(imageInfos), label)
+	return nil
+}
+
+//GetImageContext opens the image from JPEGImages/. The url of the image stays
+//empty, as VOC images don't have a public url.
+func (p *VOCDataset) GetImageContext(ctx context.Context, label string, imageInfo labelme.ImageInfo, scaled bool) (labelme.Image, error) {
+	return labelme.OpenImageContext(ctx, p.getImagePath(imageInfo), scaled)
+}
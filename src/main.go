@@ -1,27 +0,0 @@
-package main
-
-import (
-	"fmt"
-)
-
-func main() {
-	outputFolder := "../dataset"
-
-	labelMeDataset := NewLabelMeDataset(outputFolder, true)
-	labelMeDataset.Load()
-	labelMeDataset.BuildLabelMap()
-	_ = labelMeDataset.GetLabelMap()
-
-	imageInfos, err := labelMeDataset.GetImageInfos("car")
-	if err != nil {
-		fmt.Println("Couldn't get image infos: ", err.Error())
-		return
-	}
-
-	err = labelMeDataset.DownloadImages(imageInfos, "car")
-	if err != nil {
-		fmt.Println("Couldn't download image: ", err.Error())
-		return	
-	}
-	
-}
\ No newline at end of file